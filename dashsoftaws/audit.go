@@ -0,0 +1,186 @@
+package dashsoftaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// readOnlyOperationPrefixes are the prefixes of API operations without side
+// effects, which are left out of the audit log.
+var readOnlyOperationPrefixes = []string{
+	"BatchGet",
+	"Describe",
+	"Get",
+	"Head",
+	"List",
+	"Lookup",
+	"Query",
+	"Scan",
+}
+
+// redactedParameterKeywords are matched, case insensitively, against the
+// names of request parameters whose value must not end up in the audit log.
+var redactedParameterKeywords = []string{
+	"accesskeyid",
+	"certificatebody",
+	"certificatechain",
+	"password",
+	"privatekey",
+	"secret",
+	"token",
+}
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time       string      `json:"time"`
+	Service    string      `json:"service"`
+	Operation  string      `json:"operation"`
+	Region     string      `json:"region,omitempty"`
+	Parameters interface{} `json:"parameters,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+	Outcome    string      `json:"outcome"`
+	ErrorCode  string      `json:"error_code,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// auditLogger appends a JSON line to the audit log for every mutating API
+// call, so there is a trail of the side effects of the resources, such as
+// the services an ECS cluster delete scales down.
+type auditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newAuditLogger(path string) (*auditLogger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening audit_log_path %s: %s", path, err)
+	}
+	return &auditLogger{file: file}, nil
+}
+
+// completeHandler returns a named handler recording each mutating request
+// once it is complete, after all of its retries.
+func (l *auditLogger) completeHandler() request.NamedHandler {
+	return request.NamedHandler{
+		Name: "dashsoftaws.AuditLogHandler",
+		Fn: func(r *request.Request) {
+			if isReadOnlyOperation(r.Operation.Name) {
+				return
+			}
+
+			record := auditRecord{
+				Service:    r.ClientInfo.ServiceName,
+				Operation:  r.Operation.Name,
+				Region:     aws.StringValue(r.Config.Region),
+				Parameters: redactParameters(r.Params),
+				RequestID:  r.RequestID,
+				Outcome:    "success",
+			}
+
+			if r.Error != nil {
+				record.Outcome = "error"
+				record.Error = r.Error.Error()
+				if awsErr, ok := r.Error.(awserr.Error); ok {
+					record.ErrorCode = awsErr.Code()
+					record.Error = awsErr.Message()
+				}
+			}
+
+			l.write(record)
+		},
+	}
+}
+
+func (l *auditLogger) write(record auditRecord) {
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("[WARN] Error encoding audit log record for %s.%s: %s", record.Service, record.Operation, err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		log.Printf("[WARN] Error writing audit log record for %s.%s: %s", record.Service, record.Operation, err)
+	}
+}
+
+// audit appends a record of a step of a resource made of several API calls
+// to the audit log, such as the services an ECS cluster delete removed, next
+// to the records of the calls themselves. It does nothing without an audit
+// log.
+func (c *AWSClient) audit(record auditRecord) {
+	if c.auditLog == nil {
+		return
+	}
+	if record.Region == "" {
+		record.Region = c.region
+	}
+	c.auditLog.write(record)
+}
+
+func isReadOnlyOperation(operation string) bool {
+	for _, prefix := range readOnlyOperationPrefixes {
+		if strings.HasPrefix(operation, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactParameters returns the request parameters as generic JSON values,
+// with the values of secret parameters replaced.
+func redactParameters(params interface{}) interface{} {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil
+	}
+
+	return redactValue(decoded)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if isRedactedParameter(key) {
+				value[key] = "REDACTED"
+			} else {
+				value[key] = redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redactValue(child)
+		}
+	}
+	return v
+}
+
+func isRedactedParameter(name string) bool {
+	name = strings.ToLower(name)
+	for _, keyword := range redactedParameterKeywords {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,478 @@
+package dashsoftaws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// recordEnvVar names the cassette file every AWS API call made by the
+	// provider is recorded to
+	recordEnvVar = "TF_DASHSOFTAWS_RECORD"
+
+	// replayEnvVar names the cassette file the responses to every AWS API call
+	// made by the provider are replayed from, without any network access
+	replayEnvVar = "TF_DASHSOFTAWS_REPLAY"
+)
+
+// scrubbedHeaders are left out of the recorded requests, they hold the
+// credentials and signature of the request.
+var scrubbedHeaders = []string{
+	"Authorization",
+	"X-Amz-Security-Token",
+}
+
+// secretParameters are the names, in lower case, of the request and response
+// fields holding secrets, which are redacted from the recording. Only the
+// exact names are matched, as fields like NextToken, ClientToken or
+// GrantTokens have to be replayed as they were.
+var secretParameters = map[string]bool{
+	"accesskeyid":           true,
+	"certificatebody":       true,
+	"certificatechain":      true,
+	"certificateprivatekey": true,
+	"password":              true,
+	"privatekey":            true,
+	"secretaccesskey":       true,
+	"sessiontoken":          true,
+	"webidentitytoken":      true,
+}
+
+// volatileParameters are the names of the request fields that differ between
+// runs making the same API call, such as the idempotency tokens the SDK
+// generates, which are left out of the key identifying the call.
+var volatileParameters = map[string]bool{
+	"ClientRequestToken": true,
+	"ClientToken":        true,
+	"IdempotencyToken":   true,
+}
+
+// credentialsExpirationRegexp matches the expiration of the credentials
+// returned by STS, which is pushed back on replay so that the recorded
+// credentials are never considered expired.
+var credentialsExpirationRegexp = regexp.MustCompile(`<Expiration>[^<]*</Expiration>`)
+
+// xmlElementRegexp matches the leaf elements of the XML responses of the
+// query APIs, such as IAM and STS.
+var xmlElementRegexp = regexp.MustCompile(`<([A-Za-z0-9]+)>([^<]*)</([A-Za-z0-9]+)>`)
+
+// cassetteInteraction is one recorded request and its response. The key
+// identifies the API call; the recorded request is only there for reading.
+type cassetteInteraction struct {
+	Key      string           `json:"key"`
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// cassette is a file of interactions, one JSON object per line. A cassette is
+// opened once per process and shared by every provider configured in it, so
+// the provider instances configured for the steps of a resource.Test replay
+// the interactions in the order they were recorded.
+type cassette struct {
+	mu   sync.Mutex
+	path string
+
+	// file is the cassette being recorded
+	file *os.File
+
+	// interactions holds the interactions left to replay, by key
+	interactions map[string][]cassetteInteraction
+}
+
+var (
+	cassettesLock sync.Mutex
+	cassettes     = make(map[string]*cassette)
+)
+
+// wrapCassetteTransport puts the transport recording or replaying the
+// cassette named by TF_DASHSOFTAWS_RECORD or TF_DASHSOFTAWS_REPLAY in front
+// of the transport of the HTTP client. It returns whether the client now
+// replays, in which case it must not be given real credentials.
+func wrapCassetteTransport(client *http.Client) (bool, error) {
+	recordPath := os.Getenv(recordEnvVar)
+	replayPath := os.Getenv(replayEnvVar)
+
+	switch {
+	case recordPath != "" && replayPath != "":
+		return false, fmt.Errorf("%s and %s cannot both be set", recordEnvVar, replayEnvVar)
+
+	case recordPath != "":
+		c, err := openCassette(recordPath, true)
+		if err != nil {
+			return false, err
+		}
+		log.Printf("[INFO] Recording AWS API calls to %s", recordPath)
+		client.Transport = &recordingTransport{next: client.Transport, cassette: c}
+		return false, nil
+
+	case replayPath != "":
+		c, err := openCassette(replayPath, false)
+		if err != nil {
+			return false, err
+		}
+		log.Printf("[INFO] Replaying AWS API calls from %s", replayPath)
+		client.Transport = &replayingTransport{cassette: c}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// openCassette returns the cassette at path, truncating it the first time it
+// is recorded to in this process or loading it the first time it is replayed.
+func openCassette(path string, record bool) (*cassette, error) {
+	cassettesLock.Lock()
+	defer cassettesLock.Unlock()
+
+	if c, ok := cassettes[path]; ok {
+		return c, nil
+	}
+
+	c := &cassette{path: path}
+	if record {
+		file, err := os.OpenFile(path, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening cassette %s for recording: %s", path, err)
+		}
+		c.file = file
+	} else {
+		interactions, err := loadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		c.interactions = interactions
+	}
+
+	cassettes[path] = c
+	return c, nil
+}
+
+func loadCassette(path string) (map[string][]cassetteInteraction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening cassette %s for replaying: %s", path, err)
+	}
+	defer file.Close()
+
+	interactions := make(map[string][]cassetteInteraction)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var i cassetteInteraction
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			return nil, fmt.Errorf("Error parsing cassette %s line %d: %s", path, line, err)
+		}
+		interactions[i.Key] = append(interactions[i.Key], i)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading cassette %s: %s", path, err)
+	}
+
+	return interactions, nil
+}
+
+func (c *cassette) record(i cassetteInteraction) error {
+	line, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
+
+// next returns the first interaction with the key that hasn't been replayed.
+func (c *cassette) next(key string) (cassetteInteraction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	interactions := c.interactions[key]
+	if len(interactions) == 0 {
+		return cassetteInteraction{}, false
+	}
+	c.interactions[key] = interactions[1:]
+	return interactions[0], true
+}
+
+// recordingTransport passes requests on to the next transport and records
+// them, scrubbed, with their response.
+type recordingTransport struct {
+	next     http.RoundTripper
+	cassette *cassette
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	header := cloneHeader(req.Header)
+	for _, name := range scrubbedHeaders {
+		header.Del(name)
+	}
+
+	i := cassetteInteraction{
+		Key: cassetteKey(req, body),
+		Request: cassetteRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: header,
+			Body:   scrubBody(body),
+		},
+		Response: cassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     cloneHeader(resp.Header),
+			Body:       scrubBody(respBody),
+		},
+	}
+	if err := t.cassette.record(i); err != nil {
+		log.Printf("[WARN] Error recording %s to cassette %s: %s", i.Key, t.cassette.path, err)
+	}
+
+	return resp, nil
+}
+
+// replayingTransport answers every request with the next recorded response
+// to the same API call, never touching the network.
+type replayingTransport struct {
+	cassette *cassette
+}
+
+func (t *replayingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cassetteKey(req, body)
+	i, ok := t.cassette.next(key)
+	if !ok {
+		return nil, fmt.Errorf("No recorded response left in cassette %s for %s", t.cassette.path, key)
+	}
+	log.Printf("[DEBUG] Replaying %s", key)
+
+	// Recorded credentials would be expired once the cassette is older than
+	// their duration, and the SDK would ask STS for new ones
+	respBody := credentialsExpirationRegexp.ReplaceAllString(i.Response.Body,
+		"<Expiration>"+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+"</Expiration>")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cloneHeader(i.Response.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// cassetteKey identifies the API call made by a request: the method, URL, for
+// the JSON and query protocols that post every operation to the same URL, the
+// operation, and the normalized body, so that calls to one operation for
+// different resources, made in whatever order, get their own responses.
+func cassetteKey(req *http.Request, body []byte) string {
+	operation := req.Header.Get("X-Amz-Target")
+	if operation == "" && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			operation = values.Get("Action")
+		}
+	}
+
+	key := req.Method + " " + req.URL.Host + req.URL.RequestURI()
+	if operation != "" {
+		key += " " + operation
+	}
+	if normalized := normalizeBody(body); normalized != "" {
+		key += " " + normalized
+	}
+	return key
+}
+
+// normalizeBody returns the body of a request as it is keyed: JSON with
+// sorted keys or sorted form values, without the volatile fields and with the
+// secrets redacted.
+func normalizeBody(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch trimmed[0] {
+	case '{', '[':
+		var decoded interface{}
+		if err := json.Unmarshal(trimmed, &decoded); err == nil {
+			if normalized, err := json.Marshal(redactSecrets(dropVolatile(decoded))); err == nil {
+				return string(normalized)
+			}
+		}
+
+	case '<':
+		return scrubBody(body)
+
+	default:
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for key := range values {
+				if volatileParameters[key] {
+					values.Del(key)
+				}
+			}
+			return scrubBody([]byte(values.Encode()))
+		}
+	}
+
+	return string(body)
+}
+
+// dropVolatile removes the volatile fields from a decoded JSON value.
+func dropVolatile(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if volatileParameters[strings.Title(key)] {
+				delete(value, key)
+			} else {
+				dropVolatile(child)
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			dropVolatile(child)
+		}
+	}
+	return v
+}
+
+// redactSecrets replaces the values of the secret fields of a decoded JSON
+// value.
+func redactSecrets(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if isSecretParameter(key) {
+				value[key] = "REDACTED"
+			} else {
+				redactSecrets(child)
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			redactSecrets(child)
+		}
+	}
+	return v
+}
+
+func isSecretParameter(name string) bool {
+	return secretParameters[strings.ToLower(name)]
+}
+
+// readRequestBody returns the body of the request, leaving it in place for
+// the next transport.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// scrubBody redacts the secrets, such as the credentials returned by STS,
+// from a JSON, form encoded or XML body.
+func scrubBody(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch trimmed[0] {
+	case '{', '[':
+		var decoded interface{}
+		if err := json.Unmarshal(trimmed, &decoded); err == nil {
+			if scrubbed, err := json.Marshal(redactSecrets(decoded)); err == nil {
+				return string(scrubbed)
+			}
+		}
+
+	case '<':
+		return xmlElementRegexp.ReplaceAllStringFunc(string(body), func(element string) string {
+			m := xmlElementRegexp.FindStringSubmatch(element)
+			if m[1] != m[3] || !isSecretParameter(m[1]) {
+				return element
+			}
+			return "<" + m[1] + ">REDACTED</" + m[1] + ">"
+		})
+
+	default:
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for key := range values {
+				if isSecretParameter(key) {
+					values.Set(key, "REDACTED")
+				}
+			}
+			return values.Encode()
+		}
+	}
+
+	return string(body)
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
+}
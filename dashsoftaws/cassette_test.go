@@ -0,0 +1,196 @@
+package dashsoftaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCassetteRequest is a request to the fake endpoint, signed like the SDK
+// signs it: of the JSON protocol with a target, of the query protocol without.
+type testCassetteRequest struct {
+	Target string
+	Body   string
+}
+
+func (r testCassetteRequest) do(client *http.Client, url string) (string, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(r.Body))
+	if err != nil {
+		return "", err
+	}
+	if r.Target != "" {
+		req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+		req.Header.Set("X-Amz-Target", r.Target)
+	} else {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDRECORDED/20200101/us-east-1/dynamodb/aws4_request, Signature=f00d")
+	req.Header.Set("X-Amz-Security-Token", "recorded-session-token")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func TestCassette_recordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dashsoftaws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.jsonl")
+
+	// The responses tell the tables apart, and hand out credentials
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"Table":{"TableName":%q,"TableStatus":"ACTIVE"},"SecretAccessKey":"served-secret"}`, in["TableName"])
+	}))
+
+	requests := []testCassetteRequest{
+		{Target: "DynamoDB_20120810.DescribeTable", Body: `{"TableName":"orders"}`},
+		{Target: "DynamoDB_20120810.DescribeTable", Body: `{"TableName":"users"}`},
+		{Target: "DynamoDB_20120810.CreateTable", Body: `{"TableName":"events","ClientRequestToken":"recorded","SecretAccessKey":"sent-secret"}`},
+	}
+
+	os.Setenv(recordEnvVar, path)
+	recording := &http.Client{Transport: http.DefaultTransport}
+	replaying, err := wrapCassetteTransport(recording)
+	os.Unsetenv(recordEnvVar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaying {
+		t.Fatal("Expected the client to record, not to replay")
+	}
+
+	for _, r := range requests {
+		if _, err := r.do(recording, server.URL); err != nil {
+			t.Fatalf("Error recording %s: %s", r.Body, err)
+		}
+	}
+	server.Close()
+
+	// A cassette is opened once per process, so the one replayed, as by a
+	// later run, is a copy of the one recorded
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayPath := filepath.Join(dir, "replay.jsonl")
+	if err := ioutil.WriteFile(replayPath, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the network, the calls are answered from the cassette, in
+	// whatever order they are made, and the volatile fields don't matter
+	os.Setenv(replayEnvVar, replayPath)
+	replay := &http.Client{Transport: http.DefaultTransport}
+	replaying, err = wrapCassetteTransport(replay)
+	os.Unsetenv(replayEnvVar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replaying {
+		t.Fatal("Expected the client to replay")
+	}
+
+	tables := []string{"orders", "users", "events"}
+	for i := len(requests) - 1; i >= 0; i-- {
+		r := requests[i]
+		r.Body = strings.Replace(r.Body, `"ClientRequestToken":"recorded"`, `"ClientRequestToken":"replayed"`, 1)
+		body, err := r.do(replay, server.URL)
+		if err != nil {
+			t.Fatalf("Error replaying %s: %s", r.Body, err)
+		}
+		if !strings.Contains(body, fmt.Sprintf(`"TableName":%q`, tables[i])) || !strings.Contains(body, `"SecretAccessKey":"REDACTED"`) {
+			t.Errorf("Expected %s to be replayed with the response about %s, scrubbed, got %s", r.Body, tables[i], body)
+		}
+	}
+
+	// A call that was not recorded, or was already replayed, fails
+	for _, r := range []testCassetteRequest{
+		{Target: "DynamoDB_20120810.DescribeTable", Body: `{"TableName":"missing"}`},
+		requests[0],
+	} {
+		_, err := r.do(replay, server.URL)
+		if err == nil || !strings.Contains(err.Error(), "No recorded response left in cassette") {
+			t.Errorf("Expected replaying %s to fail for a missing response, got %v", r.Body, err)
+		}
+	}
+}
+
+func TestCassette_scrub(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dashsoftaws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.jsonl")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>`+
+			`<AccessKeyId>ASIASERVED</AccessKeyId><SecretAccessKey>served-secret</SecretAccessKey>`+
+			`<SessionToken>served-session-token</SessionToken><Expiration>2020-01-01T00:00:00Z</Expiration>`+
+			`</Credentials><AssumedRoleUser><Arn>arn:aws:sts::123456789012:assumed-role/test/session</Arn></AssumedRoleUser>`+
+			`</AssumeRoleResult></AssumeRoleResponse>`)
+	}))
+	defer server.Close()
+
+	os.Setenv(recordEnvVar, path)
+	client := &http.Client{Transport: http.DefaultTransport}
+	_, err = wrapCassetteTransport(client)
+	os.Unsetenv(recordEnvVar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []testCassetteRequest{
+		{Target: "DynamoDB_20120810.PutItem", Body: `{"TableName":"orders","Item":{"Password":{"S":"sent-password"}},"NextToken":"page-2"}`},
+		{Target: "", Body: "Action=AssumeRole&RoleArn=arn%3Aaws%3Aiam%3A%3A123456789012%3Arole%2Ftest&WebIdentityToken=sent-web-identity-token"},
+	}
+	for _, r := range requests {
+		if _, err := r.do(client, server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{
+		"AKIDRECORDED", "Signature=f00d", "recorded-session-token",
+		"sent-password", "sent-web-identity-token",
+		"ASIASERVED", "served-secret", "served-session-token",
+	} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("Expected %q to be scrubbed from the cassette:\n%s", secret, content)
+		}
+	}
+	for _, kept := range []string{
+		`\"TableName\":\"orders\"`, `\"NextToken\":\"page-2\"`, "RoleArn=arn%3Aaws%3Aiam",
+		"assumed-role/test/session", "2020-01-01T00:00:00Z",
+	} {
+		if !strings.Contains(string(content), kept) {
+			t.Errorf("Expected %q to be kept in the cassette:\n%s", kept, content)
+		}
+	}
+}
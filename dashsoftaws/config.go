@@ -1,11 +1,17 @@
 package dashsoftaws
 
 import (
+	"bufio"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-cleanhttp"
@@ -14,12 +20,16 @@ import (
 	"github.com/hashicorp/terraform/terraform"
 
 	"crypto/tls"
+	"crypto/x509"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/processcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/apigateway"
@@ -55,6 +65,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 type Config struct {
@@ -66,52 +77,305 @@ type Config struct {
 	Region        string
 	MaxRetries    int
 
+	RetryBaseDelayMs int
+	RetryMaxDelayMs  int
+
+	// RateLimits maps a service name from endpointServiceNames to the rate
+	// API calls to it are limited to
+	RateLimits map[string]RateLimit
+
+	AssumeRoleARN             string
+	AssumeRoleSessionName     string
+	AssumeRoleExternalID      string
+	AssumeRoleDurationSeconds int
+	AssumeRolePolicy          string
+
 	AllowedAccountIds   []interface{}
 	ForbiddenAccountIds []interface{}
 
-	DynamoDBEndpoint string
-	KinesisEndpoint  string
-	Ec2Endpoint      string
-	IamEndpoint      string
-	ElbEndpoint      string
-	Insecure         bool
+	SkipRegionValidation    bool
+	SkipCredsValidation     bool
+	SkipMetadataApiCheck    bool
+	SkipRequestingAccountId bool
+
+	// Endpoints maps a service name from endpointServiceNames to the URL
+	// that replaces the endpoint constructed from the region
+	Endpoints map[string]string
+	Insecure  bool
+
+	CustomCABundle string
+	HTTPProxy      string
+
+	// AuditLogPath is the file every mutating API call is appended to
+	AuditLogPath string
+
+	// DefaultTags are the tags of every taggable resource, unless the tags
+	// of the resource set the same key
+	DefaultTags map[string]string
+
+	// ProtectedResourcePatterns are the globs, or regular expressions between
+	// slashes, of the names of resources that must not be deleted
+	ProtectedResourcePatterns []string
 }
 
+// AWSClient hands out the service clients used by the resources. Clients are
+// only created the first time they are requested, so configuring the provider
+// doesn't pay for the many services no resource uses.
 type AWSClient struct {
-	cfconn               *cloudformation.CloudFormation
-	cloudfrontconn       *cloudfront.CloudFront
-	cloudtrailconn       *cloudtrail.CloudTrail
-	cloudwatchconn       *cloudwatch.CloudWatch
-	cloudwatchlogsconn   *cloudwatchlogs.CloudWatchLogs
-	cloudwatcheventsconn *cloudwatchevents.CloudWatchEvents
-	dsconn               *directoryservice.DirectoryService
-	dynamodbconn         *dynamodb.DynamoDB
-	ec2conn              *ec2.EC2
-	ecrconn              *ecr.ECR
-	ecsconn              *ecs.ECS
-	efsconn              *efs.EFS
-	elbconn              *elb.ELB
-	esconn               *elasticsearch.ElasticsearchService
-	apigateway           *apigateway.APIGateway
-	autoscalingconn      *autoscaling.AutoScaling
-	s3conn               *s3.S3
-	sqsconn              *sqs.SQS
-	snsconn              *sns.SNS
-	redshiftconn         *redshift.Redshift
-	r53conn              *route53.Route53
-	region               string
-	rdsconn              *rds.RDS
-	iamconn              *iam.IAM
-	kinesisconn          *kinesis.Kinesis
-	kmsconn              *kms.KMS
-	firehoseconn         *firehose.Firehose
-	elasticacheconn      *elasticache.ElastiCache
-	elasticbeanstalkconn *elasticbeanstalk.ElasticBeanstalk
-	lambdaconn           *lambda.Lambda
-	opsworksconn         *opsworks.OpsWorks
-	glacierconn          *glacier.Glacier
-	codedeployconn       *codedeploy.CodeDeploy
-	codecommitconn       *codecommit.CodeCommit
+	config    *Config
+	session   *session.Session
+	region    string
+	partition string
+	accountid string
+	callerArn string
+
+	connsLock sync.Mutex
+	conns     map[string]interface{}
+
+	rateLimiters      map[string]*tokenBucket
+	auditLog          *auditLogger
+	protectedPatterns []*regexp.Regexp
+
+	// regions caches the clients of the regions resources set other than
+	// the region of the provider
+	regionsLock sync.Mutex
+	regions     map[string]*AWSClient
+}
+
+// conn returns the client for the given service, building it with newClient
+// on first use. The session passed to newClient already carries the endpoint
+// override and the rate limit configured for the service.
+func (c *AWSClient) conn(service string, newClient func(*session.Session) interface{}) interface{} {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+
+	if conn, ok := c.conns[service]; ok {
+		return conn
+	}
+
+	log.Printf("[INFO] Initializing %s connection", service)
+	sess := c.config.endpointSession(c.session, service)
+	if limiter, ok := c.rateLimiters[service]; ok {
+		sess.Handlers.Sign.PushFrontNamed(limiter.signHandler(service))
+	}
+
+	conn := newClient(sess)
+	c.conns[service] = conn
+	return conn
+}
+
+// usEast1Session returns a copy of the session bound to us-east-1.
+// Some services exist only in us-east-1, e.g. because they manage
+// resources that can span across multiple regions, or because
+// signature format v4 requires region to be us-east-1 for global
+// endpoints:
+// http://docs.aws.amazon.com/general/latest/gr/sigv4_changes.html
+func usEast1Session(sess *session.Session) *session.Session {
+	return sess.Copy(&aws.Config{Region: aws.String("us-east-1")})
+}
+
+func (c *AWSClient) apigatewayconn() *apigateway.APIGateway {
+	return c.conn("apigateway", func(sess *session.Session) interface{} {
+		return apigateway.New(sess)
+	}).(*apigateway.APIGateway)
+}
+
+func (c *AWSClient) autoscalingconn() *autoscaling.AutoScaling {
+	return c.conn("autoscaling", func(sess *session.Session) interface{} {
+		return autoscaling.New(sess)
+	}).(*autoscaling.AutoScaling)
+}
+
+func (c *AWSClient) cfconn() *cloudformation.CloudFormation {
+	return c.conn("cloudformation", func(sess *session.Session) interface{} {
+		return cloudformation.New(sess)
+	}).(*cloudformation.CloudFormation)
+}
+
+func (c *AWSClient) cloudfrontconn() *cloudfront.CloudFront {
+	return c.conn("cloudfront", func(sess *session.Session) interface{} {
+		return cloudfront.New(sess)
+	}).(*cloudfront.CloudFront)
+}
+
+func (c *AWSClient) cloudtrailconn() *cloudtrail.CloudTrail {
+	return c.conn("cloudtrail", func(sess *session.Session) interface{} {
+		return cloudtrail.New(sess)
+	}).(*cloudtrail.CloudTrail)
+}
+
+func (c *AWSClient) cloudwatchconn() *cloudwatch.CloudWatch {
+	return c.conn("cloudwatch", func(sess *session.Session) interface{} {
+		return cloudwatch.New(sess)
+	}).(*cloudwatch.CloudWatch)
+}
+
+func (c *AWSClient) cloudwatcheventsconn() *cloudwatchevents.CloudWatchEvents {
+	return c.conn("cloudwatchevents", func(sess *session.Session) interface{} {
+		return cloudwatchevents.New(sess)
+	}).(*cloudwatchevents.CloudWatchEvents)
+}
+
+func (c *AWSClient) cloudwatchlogsconn() *cloudwatchlogs.CloudWatchLogs {
+	return c.conn("cloudwatchlogs", func(sess *session.Session) interface{} {
+		return cloudwatchlogs.New(sess)
+	}).(*cloudwatchlogs.CloudWatchLogs)
+}
+
+func (c *AWSClient) codecommitconn() *codecommit.CodeCommit {
+	return c.conn("codecommit", func(sess *session.Session) interface{} {
+		return codecommit.New(usEast1Session(sess))
+	}).(*codecommit.CodeCommit)
+}
+
+func (c *AWSClient) codedeployconn() *codedeploy.CodeDeploy {
+	return c.conn("codedeploy", func(sess *session.Session) interface{} {
+		return codedeploy.New(sess)
+	}).(*codedeploy.CodeDeploy)
+}
+
+func (c *AWSClient) dsconn() *directoryservice.DirectoryService {
+	return c.conn("directoryservice", func(sess *session.Session) interface{} {
+		return directoryservice.New(sess)
+	}).(*directoryservice.DirectoryService)
+}
+
+func (c *AWSClient) dynamodbconn() *dynamodb.DynamoDB {
+	return c.conn("dynamodb", func(sess *session.Session) interface{} {
+		return dynamodb.New(sess)
+	}).(*dynamodb.DynamoDB)
+}
+
+func (c *AWSClient) ec2conn() *ec2.EC2 {
+	return c.conn("ec2", func(sess *session.Session) interface{} {
+		return ec2.New(sess)
+	}).(*ec2.EC2)
+}
+
+func (c *AWSClient) ecrconn() *ecr.ECR {
+	return c.conn("ecr", func(sess *session.Session) interface{} {
+		return ecr.New(sess)
+	}).(*ecr.ECR)
+}
+
+func (c *AWSClient) ecsconn() *ecs.ECS {
+	return c.conn("ecs", func(sess *session.Session) interface{} {
+		return ecs.New(sess)
+	}).(*ecs.ECS)
+}
+
+func (c *AWSClient) efsconn() *efs.EFS {
+	return c.conn("efs", func(sess *session.Session) interface{} {
+		return efs.New(sess)
+	}).(*efs.EFS)
+}
+
+func (c *AWSClient) elasticacheconn() *elasticache.ElastiCache {
+	return c.conn("elasticache", func(sess *session.Session) interface{} {
+		return elasticache.New(sess)
+	}).(*elasticache.ElastiCache)
+}
+
+func (c *AWSClient) elasticbeanstalkconn() *elasticbeanstalk.ElasticBeanstalk {
+	return c.conn("elasticbeanstalk", func(sess *session.Session) interface{} {
+		return elasticbeanstalk.New(sess)
+	}).(*elasticbeanstalk.ElasticBeanstalk)
+}
+
+func (c *AWSClient) esconn() *elasticsearch.ElasticsearchService {
+	return c.conn("elasticsearch", func(sess *session.Session) interface{} {
+		return elasticsearch.New(sess)
+	}).(*elasticsearch.ElasticsearchService)
+}
+
+func (c *AWSClient) elbconn() *elb.ELB {
+	return c.conn("elb", func(sess *session.Session) interface{} {
+		return elb.New(sess)
+	}).(*elb.ELB)
+}
+
+func (c *AWSClient) firehoseconn() *firehose.Firehose {
+	return c.conn("firehose", func(sess *session.Session) interface{} {
+		return firehose.New(sess)
+	}).(*firehose.Firehose)
+}
+
+func (c *AWSClient) glacierconn() *glacier.Glacier {
+	return c.conn("glacier", func(sess *session.Session) interface{} {
+		return glacier.New(sess)
+	}).(*glacier.Glacier)
+}
+
+func (c *AWSClient) iamconn() *iam.IAM {
+	return c.conn("iam", func(sess *session.Session) interface{} {
+		return iam.New(sess)
+	}).(*iam.IAM)
+}
+
+func (c *AWSClient) kinesisconn() *kinesis.Kinesis {
+	return c.conn("kinesis", func(sess *session.Session) interface{} {
+		return kinesis.New(sess)
+	}).(*kinesis.Kinesis)
+}
+
+func (c *AWSClient) kmsconn() *kms.KMS {
+	return c.conn("kms", func(sess *session.Session) interface{} {
+		return kms.New(sess)
+	}).(*kms.KMS)
+}
+
+func (c *AWSClient) lambdaconn() *lambda.Lambda {
+	return c.conn("lambda", func(sess *session.Session) interface{} {
+		return lambda.New(sess)
+	}).(*lambda.Lambda)
+}
+
+func (c *AWSClient) opsworksconn() *opsworks.OpsWorks {
+	return c.conn("opsworks", func(sess *session.Session) interface{} {
+		return opsworks.New(usEast1Session(sess))
+	}).(*opsworks.OpsWorks)
+}
+
+func (c *AWSClient) rdsconn() *rds.RDS {
+	return c.conn("rds", func(sess *session.Session) interface{} {
+		return rds.New(sess)
+	}).(*rds.RDS)
+}
+
+func (c *AWSClient) redshiftconn() *redshift.Redshift {
+	return c.conn("redshift", func(sess *session.Session) interface{} {
+		return redshift.New(sess)
+	}).(*redshift.Redshift)
+}
+
+func (c *AWSClient) r53conn() *route53.Route53 {
+	return c.conn("route53", func(sess *session.Session) interface{} {
+		return route53.New(usEast1Session(sess))
+	}).(*route53.Route53)
+}
+
+func (c *AWSClient) s3conn() *s3.S3 {
+	return c.conn("s3", func(sess *session.Session) interface{} {
+		return s3.New(sess)
+	}).(*s3.S3)
+}
+
+func (c *AWSClient) snsconn() *sns.SNS {
+	return c.conn("sns", func(sess *session.Session) interface{} {
+		return sns.New(sess)
+	}).(*sns.SNS)
+}
+
+func (c *AWSClient) sqsconn() *sqs.SQS {
+	return c.conn("sqs", func(sess *session.Session) interface{} {
+		return sqs.New(sess)
+	}).(*sqs.SQS)
+}
+
+func (c *AWSClient) stsconn() *sts.STS {
+	return c.conn("sts", func(sess *session.Session) interface{} {
+		return sts.New(sess)
+	}).(*sts.STS)
 }
 
 // Client configures and returns a fully initialized AWSClient
@@ -120,10 +384,15 @@ func (c *Config) Client() (interface{}, error) {
 	// specified and we're attempting to use the environment.
 	var errs []error
 
-	log.Println("[INFO] Building AWS region structure")
-	err := c.ValidateRegion()
-	if err != nil {
-		errs = append(errs, err)
+	var err error
+	if c.SkipRegionValidation {
+		log.Printf("[INFO] Skipping validation of region %s", c.Region)
+	} else {
+		log.Println("[INFO] Building AWS region structure")
+		err = c.ValidateRegion()
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	var client AWSClient
@@ -132,8 +401,30 @@ func (c *Config) Client() (interface{}, error) {
 		// bucket storage in S3
 		client.region = c.Region
 
+		// store the partition the region belongs to, so resources can build
+		// ARNs for aws-cn and aws-us-gov as well
+		client.partition = partitionForRegion(c.Region)
+		log.Printf("[INFO] Using AWS partition %s", client.partition)
+
+		httpClient, err := c.httpClient()
+		if err != nil {
+			errs = append(errs, err)
+			return nil, &multierror.Error{Errors: errs}
+		}
+
+		replaying, err := wrapCassetteTransport(httpClient)
+		if err != nil {
+			errs = append(errs, err)
+			return nil, &multierror.Error{Errors: errs}
+		}
+
 		log.Println("[INFO] Building AWS auth structure")
-		creds := getCreds(c.AccessKey, c.SecretKey, c.Token, c.Profile, c.CredsFilename)
+		creds := getCreds(c, httpClient)
+		if replaying {
+			// The recorded requests are matched without their signature, and
+			// looking for real credentials could need the network
+			creds = awsCredentials.NewStaticCredentials("replay", "replay", "")
+		}
 		// Call Get to check for credential provider. If nothing found, we'll get an
 		// error, and we can present it nicely to the user
 		_, err = creds.Get()
@@ -147,222 +438,236 @@ func (c *Config) Client() (interface{}, error) {
 			}
 			return nil, &multierror.Error{Errors: errs}
 		}
+
 		awsConfig := &aws.Config{
 			Credentials: creds,
 			Region:      aws.String(c.Region),
 			MaxRetries:  aws.Int(c.MaxRetries),
-			HTTPClient:  cleanhttp.DefaultClient(),
+			HTTPClient:  httpClient,
 		}
 
+		request.WithRetryer(awsConfig, awsRetryer{
+			NumMaxRetries:  c.MaxRetries,
+			BaseRetryDelay: time.Duration(c.RetryBaseDelayMs) * time.Millisecond,
+			MaxRetryDelay:  time.Duration(c.RetryMaxDelayMs) * time.Millisecond,
+		})
+
 		if logging.IsDebugOrHigher() {
 			awsConfig.LogLevel = aws.LogLevel(aws.LogDebugWithHTTPBody)
 			awsConfig.Logger = awsLogger{}
 		}
 
-		if c.Insecure {
-			transport := awsConfig.HTTPClient.Transport.(*http.Transport)
-			transport.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
-		}
-
 		// Set up base session
 		sess := session.New(awsConfig)
 		sess.Handlers.Build.PushFrontNamed(addTerraformVersionToUserAgent)
 
-		log.Println("[INFO] Initializing IAM Connection")
-		awsIamSess := sess.Copy(&aws.Config{Endpoint: aws.String(c.IamEndpoint)})
-		client.iamconn = iam.New(awsIamSess)
-
-		err = c.ValidateCredentials(client.iamconn)
-		if err != nil {
-			errs = append(errs, err)
+		if c.AuditLogPath != "" {
+			log.Printf("[INFO] Writing audit log to %s", c.AuditLogPath)
+			auditLog, err := newAuditLogger(c.AuditLogPath)
+			if err != nil {
+				errs = append(errs, err)
+				return nil, &multierror.Error{Errors: errs}
+			}
+			sess.Handlers.Complete.PushBackNamed(auditLog.completeHandler())
+			client.auditLog = auditLog
 		}
 
-		// Some services exist only in us-east-1, e.g. because they manage
-		// resources that can span across multiple regions, or because
-		// signature format v4 requires region to be us-east-1 for global
-		// endpoints:
-		// http://docs.aws.amazon.com/general/latest/gr/sigv4_changes.html
-		usEast1Sess := sess.Copy(&aws.Config{Region: aws.String("us-east-1")})
-
-		log.Println("[INFO] Initializing DynamoDB connection")
-		dynamoSess := sess.Copy(&aws.Config{Endpoint: aws.String(c.DynamoDBEndpoint)})
-		client.dynamodbconn = dynamodb.New(dynamoSess)
-
-		log.Println("[INFO] Initializing Cloudfront connection")
-		client.cloudfrontconn = cloudfront.New(sess)
-
-		log.Println("[INFO] Initializing ELB connection")
-		awsElbSess := sess.Copy(&aws.Config{Endpoint: aws.String(c.ElbEndpoint)})
-		client.elbconn = elb.New(awsElbSess)
-
-		log.Println("[INFO] Initializing S3 connection")
-		client.s3conn = s3.New(sess)
-
-		log.Println("[INFO] Initializing SQS connection")
-		client.sqsconn = sqs.New(sess)
-
-		log.Println("[INFO] Initializing SNS connection")
-		client.snsconn = sns.New(sess)
-
-		log.Println("[INFO] Initializing RDS Connection")
-		client.rdsconn = rds.New(sess)
-
-		log.Println("[INFO] Initializing Kinesis Connection")
-		kinesisSess := sess.Copy(&aws.Config{Endpoint: aws.String(c.KinesisEndpoint)})
-		client.kinesisconn = kinesis.New(kinesisSess)
-
-		log.Println("[INFO] Initializing Elastic Beanstalk Connection")
-		client.elasticbeanstalkconn = elasticbeanstalk.New(sess)
-
-		authErr := c.ValidateAccountId(client.iamconn)
-		if authErr != nil {
-			errs = append(errs, authErr)
+		// When a role is to be assumed, the credentials found above are only
+		// used to call STS; every service client is built from a session
+		// carrying the assumed role credentials instead.
+		if c.AssumeRoleARN != "" {
+			log.Printf("[INFO] Assuming IAM role %s", c.AssumeRoleARN)
+			assumedCreds, err := c.assumeRoleCredentials(sess)
+			if err != nil {
+				errs = append(errs, err)
+				return nil, &multierror.Error{Errors: errs}
+			}
+			sess = sess.Copy(&aws.Config{Credentials: assumedCreds})
 		}
 
-		log.Println("[INFO] Initializing Kinesis Firehose Connection")
-		client.firehoseconn = firehose.New(sess)
-
-		log.Println("[INFO] Initializing AutoScaling connection")
-		client.autoscalingconn = autoscaling.New(sess)
-
-		log.Println("[INFO] Initializing EC2 Connection")
-
-		awsEc2Sess := sess.Copy(&aws.Config{Endpoint: aws.String(c.Ec2Endpoint)})
-		client.ec2conn = ec2.New(awsEc2Sess)
-
-		log.Println("[INFO] Initializing ECR Connection")
-		client.ecrconn = ecr.New(sess)
-
-		log.Println("[INFO] Initializing API Gateway")
-		client.apigateway = apigateway.New(sess)
-
-		log.Println("[INFO] Initializing ECS Connection")
-		client.ecsconn = ecs.New(sess)
+		client.config = c
+		client.session = sess
+		client.conns = make(map[string]interface{})
 
-		log.Println("[INFO] Initializing EFS Connection")
-		client.efsconn = efs.New(sess)
-
-		log.Println("[INFO] Initializing ElasticSearch Connection")
-		client.esconn = elasticsearch.New(sess)
-
-		log.Println("[INFO] Initializing Route 53 connection")
-		client.r53conn = route53.New(usEast1Sess)
+		client.rateLimiters = make(map[string]*tokenBucket)
+		for service, limit := range c.RateLimits {
+			log.Printf("[INFO] Limiting %s API calls to %g per second", service, limit.RequestsPerSecond)
+			client.rateLimiters[service] = newTokenBucket(limit)
+		}
 
-		log.Println("[INFO] Initializing Elasticache Connection")
-		client.elasticacheconn = elasticache.New(sess)
+		for _, pattern := range c.ProtectedResourcePatterns {
+			protectedPattern, err := compileProtectedPattern(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Error in protected_resource_patterns entry %q: %s", pattern, err))
+				return nil, &multierror.Error{Errors: errs}
+			}
+			client.protectedPatterns = append(client.protectedPatterns, protectedPattern)
+		}
 
-		log.Println("[INFO] Initializing Lambda Connection")
-		client.lambdaconn = lambda.New(sess)
+		// Looking up the account ID and validating the credentials are the same
+		// STS call, so it is only skipped when both are. With the validation
+		// skipped, e.g. for APIs without STS, a failed lookup is not fatal
+		if c.SkipCredsValidation && c.SkipRequestingAccountId {
+			log.Println("[INFO] Skipping credentials validation and account ID lookup")
+		} else {
+			log.Println("[INFO] Requesting caller identity")
+			identity, err := c.ValidateCredentials(client.stsconn())
+			switch {
+			case err != nil && !c.SkipCredsValidation:
+				errs = append(errs, err)
+				return nil, &multierror.Error{Errors: errs}
+
+			case err != nil:
+				log.Printf("[WARN] Carrying on without the account ID, skip_credentials_validation is set: %s", err)
+
+			default:
+				client.accountid = *identity.Account
+				client.callerArn = *identity.Arn
+
+				// The partition in the caller ARN is authoritative, it also
+				// covers regions unknown to the SDK
+				if arnParts := strings.Split(client.callerArn, ":"); len(arnParts) > 1 && arnParts[1] != "" {
+					client.partition = arnParts[1]
+				}
+				log.Printf("[INFO] Using account %s as %s", client.accountid, client.callerArn)
+			}
+		}
 
-		log.Println("[INFO] Initializing Cloudformation Connection")
-		client.cfconn = cloudformation.New(sess)
+		if c.SkipRequestingAccountId || client.accountid == "" {
+			if c.AllowedAccountIds != nil || c.ForbiddenAccountIds != nil {
+				errs = append(errs, fmt.Errorf(
+					"allowed_account_ids and forbidden_account_ids cannot be checked without the account ID, "+
+						"which skip_requesting_account_id or a failed lookup left out"))
+			}
+		} else {
+			authErr := c.ValidateAccountId(client.accountid)
+			if authErr != nil {
+				errs = append(errs, authErr)
+			}
+		}
+	}
 
-		log.Println("[INFO] Initializing CloudWatch SDK connection")
-		client.cloudwatchconn = cloudwatch.New(sess)
+	if len(errs) > 0 {
+		return nil, &multierror.Error{Errors: errs}
+	}
 
-		log.Println("[INFO] Initializing CloudWatch Events connection")
-		client.cloudwatcheventsconn = cloudwatchevents.New(sess)
+	return &client, nil
+}
 
-		log.Println("[INFO] Initializing CloudTrail connection")
-		client.cloudtrailconn = cloudtrail.New(sess)
+// httpClient returns the HTTP client shared by all service clients, with the
+// TLS and proxy settings of the provider applied to its transport.
+func (c *Config) httpClient() (*http.Client, error) {
+	client := cleanhttp.DefaultClient()
+	transport := client.Transport.(*http.Transport)
 
-		log.Println("[INFO] Initializing CloudWatch Logs connection")
-		client.cloudwatchlogsconn = cloudwatchlogs.New(sess)
+	tlsConfig := &tls.Config{}
 
-		log.Println("[INFO] Initializing OpsWorks Connection")
-		client.opsworksconn = opsworks.New(usEast1Sess)
+	if c.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+	}
 
-		log.Println("[INFO] Initializing Directory Service connection")
-		client.dsconn = directoryservice.New(sess)
+	if c.CustomCABundle != "" {
+		bundle, err := loadCABundle(c.CustomCABundle)
+		if err != nil {
+			return nil, err
+		}
 
-		log.Println("[INFO] Initializing Glacier connection")
-		client.glacierconn = glacier.New(sess)
+		// Like the AWS CLI, the bundle replaces the system roots rather than
+		// adding to them
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("No PEM encoded certificates found in custom_ca_bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
 
-		log.Println("[INFO] Initializing CodeDeploy Connection")
-		client.codedeployconn = codedeploy.New(sess)
+	transport.TLSClientConfig = tlsConfig
 
-		log.Println("[INFO] Initializing CodeCommit SDK connection")
-		client.codecommitconn = codecommit.New(usEast1Sess)
+	// Without http_proxy the transport keeps using the proxy from the
+	// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables
+	if c.HTTPProxy != "" {
+		proxyURL, err := url.Parse(c.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing http_proxy %q: %s", c.HTTPProxy, err)
+		}
+		log.Printf("[INFO] Using HTTP proxy %s", proxyURL.Host)
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
 
-		log.Println("[INFO] Initializing Redshift SDK connection")
-		client.redshiftconn = redshift.New(sess)
+	return client, nil
+}
 
-		log.Println("[INFO] Initializing KMS connection")
-		client.kmsconn = kms.New(sess)
+// loadCABundle returns the PEM content of custom_ca_bundle, which is either
+// the PEM content itself or the path of a file holding it.
+func loadCABundle(bundle string) ([]byte, error) {
+	if strings.Contains(bundle, "-----BEGIN") {
+		return []byte(bundle), nil
 	}
 
-	if len(errs) > 0 {
-		return nil, &multierror.Error{Errors: errs}
+	content, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading custom_ca_bundle %s: %s", bundle, err)
 	}
+	return content, nil
+}
 
-	return &client, nil
+// endpointSession returns a copy of the session using the endpoint override
+// configured for the given service, if any.
+func (c *Config) endpointSession(sess *session.Session, service string) *session.Session {
+	return sess.Copy(&aws.Config{Endpoint: aws.String(c.Endpoints[service])})
 }
 
 // ValidateRegion returns an error if the configured region is not a
-// valid aws region and nil otherwise.
+// valid aws region and nil otherwise. A region is valid when one of the
+// partitions known to the SDK lists it, or when it matches the region naming
+// scheme of a partition, so regions launched after the SDK was built pass too.
 func (c *Config) ValidateRegion() error {
-	var regions = [12]string{"us-east-1", "us-west-2", "us-west-1", "eu-west-1",
-		"eu-central-1", "ap-southeast-1", "ap-southeast-2", "ap-northeast-1",
-		"ap-northeast-2", "sa-east-1", "cn-north-1", "us-gov-west-1"}
+	return validateRegion(c.Region)
+}
 
-	for _, valid := range regions {
-		if c.Region == valid {
-			return nil
-		}
+func validateRegion(region string) error {
+	if _, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return nil
 	}
-	return fmt.Errorf("Not a valid region: %s", c.Region)
+	return fmt.Errorf("Not a valid region: %s", region)
 }
 
-// Validate credentials early and fail before we do any graph walking.
-// In the case of an IAM role/profile with insuffecient privileges, fail
-// silently
-func (c *Config) ValidateCredentials(iamconn *iam.IAM) error {
-	_, err := iamconn.GetUser(nil)
+// partitionForRegion returns the ID of the partition (aws, aws-cn,
+// aws-us-gov, ...) the region belongs to. Regions unknown to the SDK, which
+// can only get here with skip_region_validation, are assumed to be in the
+// standard aws partition.
+func partitionForRegion(region string) string {
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return p.ID()
+	}
+	return endpoints.AwsPartitionID
+}
 
-	if awsErr, ok := err.(awserr.Error); ok {
-		if awsErr.Code() == "AccessDenied" || awsErr.Code() == "ValidationError" {
-			log.Printf("[WARN] AccessDenied Error with iam.GetUser, assuming IAM profile")
-			// User may be an IAM instance profile, or otherwise IAM role without the
-			// GetUser permissions, so fail silently
-			return nil
-		}
+// ValidateCredentials validates the credentials early and fails before we do
+// any graph walking. It returns the identity the credentials belong to, which
+// STS reports for IAM users, assumed roles, federated users and instance
+// profiles alike.
+func (c *Config) ValidateCredentials(stsconn *sts.STS) (*sts.GetCallerIdentityOutput, error) {
+	out, err := stsconn.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 
-		if awsErr.Code() == "SignatureDoesNotMatch" {
-			return fmt.Errorf("Failed authenticating with AWS: please verify credentials")
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "SignatureDoesNotMatch" {
+			return nil, fmt.Errorf("Failed authenticating with AWS: please verify credentials")
 		}
+		return nil, fmt.Errorf("Failed getting caller identity from STS: %s", err)
 	}
 
-	return err
+	return out, nil
 }
 
 // ValidateAccountId returns a context-specific error if the configured account
 // id is explicitly forbidden or not authorised; and nil if it is authorised.
-func (c *Config) ValidateAccountId(iamconn *iam.IAM) error {
+func (c *Config) ValidateAccountId(account_id string) error {
 	if c.AllowedAccountIds == nil && c.ForbiddenAccountIds == nil {
 		return nil
 	}
 
-	log.Printf("[INFO] Validating account ID")
-
-	out, err := iamconn.GetUser(nil)
-
-	if err != nil {
-		awsErr, _ := err.(awserr.Error)
-		if awsErr.Code() == "ValidationError" {
-			log.Printf("[WARN] ValidationError with iam.GetUser, assuming its an IAM profile")
-			// User may be an IAM instance profile, so fail silently.
-			// If it is an IAM instance profile
-			// validating account might be superfluous
-			return nil
-		} else {
-			return fmt.Errorf("Failed getting account ID from IAM: %s", err)
-			// return error if the account id is explicitly not authorised
-		}
-	}
-
-	account_id := strings.Split(*out.User.Arn, ":")[4]
+	log.Printf("[INFO] Validating account ID %s", account_id)
 
 	if c.ForbiddenAccountIds != nil {
 		for _, id := range c.ForbiddenAccountIds {
@@ -384,22 +689,110 @@ func (c *Config) ValidateAccountId(iamconn *iam.IAM) error {
 	return nil
 }
 
+// assumeRoleCredentials returns credentials for the configured role, assumed
+// through STS with the credentials of the given session.
+func (c *Config) assumeRoleCredentials(sess *session.Session) (*awsCredentials.Credentials, error) {
+	sessionName := c.AssumeRoleSessionName
+	if sessionName == "" {
+		sessionName = "terraform-dashsoftaws"
+	}
+
+	provider := &stscreds.AssumeRoleProvider{
+		Client:          sts.New(c.endpointSession(sess, "sts")),
+		RoleARN:         c.AssumeRoleARN,
+		RoleSessionName: sessionName,
+	}
+
+	if c.AssumeRoleDurationSeconds > 0 {
+		provider.Duration = time.Duration(c.AssumeRoleDurationSeconds) * time.Second
+	}
+
+	if c.AssumeRoleExternalID != "" {
+		provider.ExternalID = aws.String(c.AssumeRoleExternalID)
+	}
+
+	if c.AssumeRolePolicy != "" {
+		provider.Policy = aws.String(c.AssumeRolePolicy)
+	}
+
+	creds := awsCredentials.NewCredentials(provider)
+
+	// Assume the role right away so a bad role ARN or trust policy is
+	// reported while configuring the provider
+	if _, err := creds.Get(); err != nil {
+		return nil, fmt.Errorf("Error assuming role %s: %s", c.AssumeRoleARN, err)
+	}
+
+	return creds, nil
+}
+
+// arnService returns the service part of an ARN such as
+// arn:aws:lambda:eu-west-1:123456789012:function:name, or an empty string
+// if the value is not an ARN
+func arnService(arn string) string {
+	parts := strings.SplitN(arn, ":", 4)
+	if len(parts) < 4 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[2]
+}
+
 // This function is responsible for reading credentials from the
 // environment in the case that they're not explicitly specified
-// in the Terraform configuration.
-func getCreds(key, secret, token, profile, credsfile string) *awsCredentials.Credentials {
+// in the Terraform configuration. The first source yielding credentials
+// wins, in this order:
+//
+//  1. access_key, secret_key and token of the provider
+//  2. AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//  3. the web identity token in AWS_WEB_IDENTITY_TOKEN_FILE exchanged for
+//     AWS_ROLE_ARN, as set up for OIDC federated CI runners and pods
+//  4. the profile in the shared credentials file
+//  5. credential_process of the profile in the shared config file
+//  6. the EC2 instance role, unless skip_metadata_api_check is set
+func getCreds(c *Config, httpClient *http.Client) *awsCredentials.Credentials {
 	// build a chain provider, lazy-evaulated by aws-sdk
 	providers := []awsCredentials.Provider{
 		&awsCredentials.StaticProvider{Value: awsCredentials.Value{
-			AccessKeyID:     key,
-			SecretAccessKey: secret,
-			SessionToken:    token,
+			AccessKeyID:     c.AccessKey,
+			SecretAccessKey: c.SecretKey,
+			SessionToken:    c.Token,
 		}},
 		&awsCredentials.EnvProvider{},
-		&awsCredentials.SharedCredentialsProvider{
-			Filename: credsfile,
-			Profile:  profile,
-		},
+	}
+
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	if tokenFile != "" && roleARN != "" {
+		sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = "terraform-dashsoftaws"
+		}
+
+		log.Printf("[DEBUG] Web identity token file found, adding Web Identity Credential Provider for %s", roleARN)
+		// AssumeRoleWithWebIdentity is authenticated by the token, so the
+		// STS client doesn't need (and can't have yet) any credentials
+		stsconn := sts.New(session.New(&aws.Config{
+			Credentials: awsCredentials.AnonymousCredentials,
+			Region:      aws.String(c.Region),
+			Endpoint:    aws.String(c.Endpoints["sts"]),
+			HTTPClient:  httpClient,
+		}))
+		providers = append(providers, stscreds.NewWebIdentityRoleProvider(stsconn, roleARN, sessionName, tokenFile))
+	}
+
+	providers = append(providers, &awsCredentials.SharedCredentialsProvider{
+		Filename: c.CredsFilename,
+		Profile:  c.Profile,
+	})
+
+	if command := sharedConfigCredentialProcess(c.Profile); command != "" {
+		log.Printf("[DEBUG] credential_process found in shared config, adding Process Credential Provider")
+		providers = append(providers, &credentialsProvider{processcreds.NewCredentials(command)})
+	}
+
+	if c.SkipMetadataApiCheck {
+		log.Printf("[DEBUG] Skipping EC2 Metadata service check, not adding EC2 Role Credential Provider")
+		return awsCredentials.NewChainCredentials(providers)
 	}
 
 	// We only look in the EC2 metadata API if we can connect
@@ -408,11 +801,11 @@ func getCreds(key, secret, token, profile, credsfile string) *awsCredentials.Cre
 	if metadataURL == "" {
 		metadataURL = "http://169.254.169.254:80/latest"
 	}
-	c := http.Client{
+	metadataClient := http.Client{
 		Timeout: 100 * time.Millisecond,
 	}
 
-	r, err := c.Get(metadataURL)
+	r, err := metadataClient.Get(metadataURL)
 	// Flag to determine if we should add the EC2Meta data provider. Default false
 	var useIAM bool
 	if err == nil {
@@ -437,6 +830,74 @@ func getCreds(key, secret, token, profile, credsfile string) *awsCredentials.Cre
 	return awsCredentials.NewChainCredentials(providers)
 }
 
+// sharedConfigCredentialProcess returns the credential_process command of the
+// profile in the shared config file (AWS_CONFIG_FILE or ~/.aws/config), or an
+// empty string if there is none.
+func sharedConfigCredentialProcess(profile string) string {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	filename := os.Getenv("AWS_CONFIG_FILE")
+	if filename == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			home = os.Getenv("USERPROFILE")
+		}
+		filename = filepath.Join(home, ".aws", "config")
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// Profiles other than default are named "[profile name]" in the config
+	// file, unlike in the credentials file
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(strings.TrimPrefix(line[1:len(line)-1], "profile "))
+			continue
+		}
+
+		if section != profile {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "credential_process" {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+
+	return ""
+}
+
+// credentialsProvider lets credentials which come with their own provider,
+// such as the ones of credential_process, take part in a provider chain.
+type credentialsProvider struct {
+	creds *awsCredentials.Credentials
+}
+
+func (p *credentialsProvider) Retrieve() (awsCredentials.Value, error) {
+	return p.creds.Get()
+}
+
+func (p *credentialsProvider) IsExpired() bool {
+	return p.creds.IsExpired()
+}
+
 // addTerraformVersionToUserAgent is a named handler that will add Terraform's
 // version information to requests made by the AWS SDK.
 var addTerraformVersionToUserAgent = request.NamedHandler{
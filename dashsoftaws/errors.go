@@ -0,0 +1,96 @@
+package dashsoftaws
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	accessDeniedHint     = "the credentials of the provider, or its assume_role role, are not allowed to call %s; grant it in their IAM policy, and check service control policies and the key or resource policy if any."
+	limitExceededHint    = "an AWS quota was reached by %s; request an increase in Service Quotas, or apply fewer resources at once with -parallelism or a rate_limit block."
+	resourceInUseHint    = "the resource is still being changed by another operation than %s, or already exists; wait for it to settle and apply again, or raise the timeouts of the resource."
+	invalidParameterHint = "AWS rejected an argument of %s; check the attributes of the resource against the AWS documentation of the operation."
+)
+
+// awsErrorHints are the remediation hints of the AWS error codes that
+// usually point at the configuration or the account rather than at the
+// provider, by error code without its Exception suffix.
+var awsErrorHints = map[string]string{
+	"AccessDenied":          accessDeniedHint,
+	"UnauthorizedOperation": accessDeniedHint,
+	"LimitExceeded":         limitExceededHint,
+	"ResourceInUse":         resourceInUseHint,
+	"InvalidParameter":      invalidParameterHint,
+	"InvalidParameterValue": invalidParameterHint,
+	"Validation":            invalidParameterHint,
+}
+
+// awsAPIError is an error of an AWS API call made for a resource, with what
+// is needed to act on it: the resource, the operation, the AWS error code and
+// the request ID to quote to AWS support. It is an awserr.Error itself, so
+// checks on the error code keep working on wrapped errors.
+type awsAPIError struct {
+	resource  string
+	operation string
+	err       error
+}
+
+// awsError wraps the error of the AWS operation called for the resource,
+// given as its type and name or ID, e.g. dashsoftaws_ecs_cluster and the
+// cluster name. It returns nil for a nil error.
+func awsError(resourceType, name, operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*awsAPIError); ok {
+		return err
+	}
+
+	resource := resourceType
+	if name != "" {
+		resource = fmt.Sprintf("%s %q", resourceType, name)
+	}
+	return &awsAPIError{resource: resource, operation: operation, err: err}
+}
+
+func (e *awsAPIError) Error() string {
+	awsErr, ok := e.err.(awserr.Error)
+	if !ok {
+		return fmt.Sprintf("%s: %s failed: %s", e.resource, e.operation, e.err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s: %s failed with %s: %s", e.resource, e.operation, awsErr.Code(), awsErr.Message())
+	if reqErr, ok := e.err.(awserr.RequestFailure); ok && reqErr.RequestID() != "" {
+		fmt.Fprintf(&b, " (HTTP %d, request ID %s)", reqErr.StatusCode(), reqErr.RequestID())
+	}
+	if hint, ok := awsErrorHints[strings.TrimSuffix(awsErr.Code(), "Exception")]; ok {
+		fmt.Fprintf(&b, ". Hint: "+hint, e.operation)
+	}
+	return b.String()
+}
+
+// Code returns the AWS error code, or an empty string for errors that did not
+// come from AWS.
+func (e *awsAPIError) Code() string {
+	if awsErr, ok := e.err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+// Message returns the message of the AWS error.
+func (e *awsAPIError) Message() string {
+	if awsErr, ok := e.err.(awserr.Error); ok {
+		return awsErr.Message()
+	}
+	return e.err.Error()
+}
+
+// OrigErr returns the error of the AWS call.
+func (e *awsAPIError) OrigErr() error {
+	return e.err
+}
@@ -0,0 +1,86 @@
+package dashsoftaws
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// deletionProtectionSchema is the deletion_protection attribute of the
+// resources whose delete cascades to other resources.
+func deletionProtectionSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Refuse to delete the resource until this is set back to false and applied.",
+	}
+}
+
+// compileProtectedPattern compiles an entry of protected_resource_patterns.
+// An entry between slashes is a regular expression matched anywhere in the
+// name, anything else a glob matching the whole name, where * stands for any
+// run of characters and ? for one character.
+func compileProtectedPattern(pattern string) (*regexp.Regexp, error) {
+	if isProtectedPatternRegexp(pattern) {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+
+	var expr bytes.Buffer
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// isProtectedPatternRegexp tells whether an entry of
+// protected_resource_patterns is a regular expression rather than a glob.
+func isProtectedPatternRegexp(pattern string) bool {
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+func validateProtectedPattern(v interface{}, k string) (ws []string, errors []error) {
+	pattern := v.(string)
+	if _, err := compileProtectedPattern(pattern); err != nil {
+		syntax := "glob"
+		if isProtectedPatternRegexp(pattern) {
+			syntax = "regular expression"
+		}
+		errors = append(errors, fmt.Errorf("%q is not a valid %s: %s", k, syntax, err))
+	}
+	return
+}
+
+// checkDeletionAllowed returns an error when the resource is protected from
+// deletion, either by its deletion_protection attribute or because its name
+// matches protected_resource_patterns. Deletes call it before any side effect,
+// so a refused destroy leaves everything in place.
+func checkDeletionAllowed(d *schema.ResourceData, meta interface{}, resourceType string, name string) error {
+	if d.Get("deletion_protection").(bool) {
+		return fmt.Errorf("Refusing to delete %s %s: deletion_protection is set. "+
+			"Set deletion_protection to false and apply before destroying it", resourceType, name)
+	}
+
+	client := meta.(*AWSClient)
+	for i, pattern := range client.protectedPatterns {
+		if pattern.MatchString(name) {
+			return fmt.Errorf("Refusing to delete %s %s: the name matches %q of protected_resource_patterns. "+
+				"Remove the pattern from the provider configuration before destroying it",
+				resourceType, name, client.config.ProtectedResourcePatterns[i])
+		}
+	}
+
+	return nil
+}
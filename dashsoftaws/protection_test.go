@@ -0,0 +1,60 @@
+package dashsoftaws
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateProtectedPattern(t *testing.T) {
+	cases := []struct {
+		Pattern string
+		Error   string
+	}{
+		{Pattern: "prod-*"},
+		{Pattern: "db-??"},
+		{Pattern: "/^prod-[a-z]+$/"},
+		{Pattern: "/prod-(/", Error: "is not a valid regular expression"},
+		// Outside slashes, ( is a character of the name
+		{Pattern: "prod-("},
+	}
+
+	for _, tc := range cases {
+		_, errors := validateProtectedPattern(tc.Pattern, "protected_resource_patterns")
+		if tc.Error == "" {
+			if len(errors) != 0 {
+				t.Errorf("Expected %q to be valid, got %s", tc.Pattern, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0].Error(), tc.Error) {
+			t.Errorf("Expected %q to fail with %q, got %s", tc.Pattern, tc.Error, errors)
+		}
+	}
+}
+
+func TestCompileProtectedPattern(t *testing.T) {
+	cases := []struct {
+		Pattern string
+		Name    string
+		Match   bool
+	}{
+		{"prod-*", "prod-api", true},
+		{"prod-*", "staging-prod-api", false},
+		{"db-??", "db-01", true},
+		{"db-??", "db-001", false},
+		{"a.b", "axb", false},
+		{"/prod/", "staging-prod-api", true},
+		{"/^prod-[0-9]+$/", "prod-12", true},
+		{"/^prod-[0-9]+$/", "prod-api", false},
+	}
+
+	for _, tc := range cases {
+		re, err := compileProtectedPattern(tc.Pattern)
+		if err != nil {
+			t.Fatalf("Compiling %q: %s", tc.Pattern, err)
+		}
+		if re.MatchString(tc.Name) != tc.Match {
+			t.Errorf("Expected %q matching %q to be %t", tc.Pattern, tc.Name, tc.Match)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package dashsoftaws
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/mutexkv"
@@ -64,6 +65,34 @@ func Provider() terraform.ResourceProvider {
 				InputDefault: "us-east-1",
 			},
 
+			"skip_region_validation": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: descriptions["skip_region_validation"],
+			},
+
+			"skip_credentials_validation": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: descriptions["skip_credentials_validation"],
+			},
+
+			"skip_metadata_api_check": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: descriptions["skip_metadata_api_check"],
+			},
+
+			"skip_requesting_account_id": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: descriptions["skip_requesting_account_id"],
+			},
+
 			"max_retries": &schema.Schema{
 				Type:        schema.TypeInt,
 				Optional:    true,
@@ -71,6 +100,24 @@ func Provider() terraform.ResourceProvider {
 				Description: descriptions["max_retries"],
 			},
 
+			"retry_base_delay_ms": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     500,
+				Description: descriptions["retry_base_delay_ms"],
+			},
+
+			"retry_max_delay_ms": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     60000,
+				Description: descriptions["retry_max_delay_ms"],
+			},
+
+			"assume_role": assumeRoleSchema(),
+
+			"rate_limit": rateLimitSchema(),
+
 			"allowed_account_ids": &schema.Schema{
 				Type:          schema.TypeSet,
 				Elem:          &schema.Schema{Type: schema.TypeString},
@@ -92,6 +139,7 @@ func Provider() terraform.ResourceProvider {
 				Optional:    true,
 				Default:     "",
 				Description: descriptions["dynamodb_endpoint"],
+				Deprecated:  "Use the dynamodb attribute of the endpoints block instead",
 			},
 
 			"kinesis_endpoint": &schema.Schema{
@@ -99,6 +147,7 @@ func Provider() terraform.ResourceProvider {
 				Optional:    true,
 				Default:     "",
 				Description: descriptions["kinesis_endpoint"],
+				Deprecated:  "Use the kinesis attribute of the endpoints block instead",
 			},
 			"endpoints": endpointsSchema(),
 
@@ -108,18 +157,64 @@ func Provider() terraform.ResourceProvider {
 				Default:     false,
 				Description: descriptions["insecure"],
 			},
+
+			"custom_ca_bundle": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("AWS_CA_BUNDLE", ""),
+				Description: descriptions["custom_ca_bundle"],
+			},
+
+			"http_proxy": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: descriptions["http_proxy"],
+			},
+
+			"audit_log_path": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: descriptions["audit_log_path"],
+			},
+
+			"protected_resource_patterns": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateProtectedPattern,
+				},
+				Description: descriptions["protected_resource_patterns"],
+			},
+
+			"default_tags": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"tags": &schema.Schema{
+							Type:        schema.TypeMap,
+							Optional:    true,
+							Description: descriptions["default_tags_tags"],
+						},
+					},
+				},
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"dashsoftaws_api_gateway_base_path_mapping":      resourceDashsoftAwsApiGatewayBasePathMapping(),
-			"dashsoftaws_api_gateway_client_certificate":     resourceDashsoftAwsApiGatewayClientCertificate(),
-			"dashsoftaws_api_gateway_deployment":             resourceDashsoftAwsApiGatewayDeployment(),
-			"dashsoftaws_api_gateway_domain_name":            resourceDashsoftAwsApiGatewayDomainName(),
-			"dashsoftaws_cloudwatch_log_subscription_filter": resourceDashsoftAwsCloudwatchLogSubscriptionFilter(),
-			"dashsoftaws_dynamodb_table":                     resourceDashsoftAwsDynamodbTable(),
-			"dashsoftaws_ecs_cluster":                        resourceDashsoftAwsEcsCluster(),
+			"dashsoftaws_api_gateway_base_path_mapping":      withRegion(resourceDashsoftAwsApiGatewayBasePathMapping()),
+			"dashsoftaws_api_gateway_client_certificate":     withRegion(resourceDashsoftAwsApiGatewayClientCertificate()),
+			"dashsoftaws_api_gateway_deployment":             withRegion(resourceDashsoftAwsApiGatewayDeployment()),
+			"dashsoftaws_api_gateway_domain_name":            withRegion(resourceDashsoftAwsApiGatewayDomainName()),
+			"dashsoftaws_cloudwatch_log_subscription_filter": withRegion(resourceDashsoftAwsCloudwatchLogSubscriptionFilter()),
+			"dashsoftaws_dynamodb_table":                     withRegion(resourceDashsoftAwsDynamodbTable()),
+			"dashsoftaws_ecs_cluster":                        withRegion(resourceDashsoftAwsEcsCluster()),
 			"dashsoftaws_iam_group":                          resourceDashsoftAwsIamGroup(),
-			"dashsoftaws_kms_grant":                          resourceDashsoftAwsKMSGrant(),
+			"dashsoftaws_kms_grant":                          withRegion(resourceDashsoftAwsKMSGrant()),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -148,9 +243,26 @@ func init() {
 		"token": "session token. A session token is only required if you are\n" +
 			"using temporary security credentials.",
 
+		"skip_region_validation": "Skip static validation of region name. Used by users of\n" +
+			"alternative AWS-like APIs or users with access to regions that are not public (yet).",
+
+		"skip_credentials_validation": "Skip the credentials validation via the STS API.\n" +
+			"Used for AWS API implementations that do not have STS available or implemented.",
+
+		"skip_metadata_api_check": "Skip the EC2 metadata API check. Used when no EC2 instance role\n" +
+			"credentials are wanted, e.g. without network access.",
+
+		"skip_requesting_account_id": "Skip requesting the account ID. Cannot be combined with\n" +
+			"allowed_account_ids or forbidden_account_ids.",
+
 		"max_retries": "The maximum number of times an AWS API request is\n" +
 			"being executed. If the API request still fails, an error is\n" +
-			"thrown.",
+			"thrown. Throttling and eventual consistency errors are retried as well.",
+
+		"retry_base_delay_ms": "The delay, in milliseconds, the exponential backoff between retries\n" +
+			"starts from. Each retry waits a random time up to this delay times 2^attempt.",
+
+		"retry_max_delay_ms": "The upper limit, in milliseconds, of the delay between retries.",
 
 		"dynamodb_endpoint": "Use this to override the default endpoint URL constructed from the `region`.\n" +
 			"It's typically used to connect to dynamodb-local.",
@@ -158,38 +270,124 @@ func init() {
 		"kinesis_endpoint": "Use this to override the default endpoint URL constructed from the `region`.\n" +
 			"It's typically used to connect to kinesalite.",
 
-		"iam_endpoint": "Use this to override the default endpoint URL constructed from the `region`.\n",
+		"endpoint": "Use this to override the default endpoint URL constructed from the `region`.\n",
+
+		"rate_limit_service": "The service whose API calls are limited, named as in the endpoints block.",
+
+		"rate_limit_requests_per_second": "The sustained number of API calls per second allowed to the service\n" +
+			"across all resources.",
 
-		"ec2_endpoint": "Use this to override the default endpoint URL constructed from the `region`.\n",
+		"rate_limit_burst": "The number of API calls allowed at once before the rate applies. If omitted,\n" +
+			"one second worth of calls is allowed.",
 
-		"elb_endpoint": "Use this to override the default endpoint URL constructed from the `region`.\n",
+		"assume_role_role_arn": "The ARN of an IAM role to assume prior to making API calls.",
+
+		"assume_role_session_name": "The session name to use when assuming the role. If omitted,\n" +
+			"`terraform-dashsoftaws` is used.",
+
+		"assume_role_external_id": "The external ID to use when assuming the role.",
+
+		"assume_role_duration_seconds": "The duration, in seconds, of the role session. If omitted,\n" +
+			"the STS default of 15 minutes is used.",
+
+		"assume_role_policy": "An IAM policy in JSON format that further restricts the\n" +
+			"permissions of the assumed role session.",
 
 		"insecure": "Explicitly allow the provider to perform \"insecure\" SSL requests. If omitted," +
 			"default value is `false`",
+
+		"custom_ca_bundle": "File path or PEM content of a bundle of CA certificates used to verify\n" +
+			"the TLS certificates of the AWS endpoints instead of the system roots.\n" +
+			"Can also be set with the AWS_CA_BUNDLE environment variable.",
+
+		"http_proxy": "URL of the HTTP proxy used for all AWS API calls. If omitted, the\n" +
+			"HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.",
+
+		"audit_log_path": "Path of a file every mutating AWS API call is appended to, as one\n" +
+			"JSON line with the service, operation, parameters, request ID and outcome.",
+
+		"protected_resource_patterns": "Names of ECS clusters and IAM groups the provider refuses to delete,\n" +
+			"as globs (prod-*) or regular expressions between slashes (/^prod-/).",
+
+		"default_tags_tags": "Tags added to every resource that supports tags. The tags of a\n" +
+			"resource override the default tags with the same key.",
 	}
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	config := Config{
-		AccessKey:        d.Get("access_key").(string),
-		SecretKey:        d.Get("secret_key").(string),
-		Profile:          d.Get("profile").(string),
-		CredsFilename:    d.Get("shared_credentials_file").(string),
-		Token:            d.Get("token").(string),
-		Region:           d.Get("region").(string),
-		MaxRetries:       d.Get("max_retries").(int),
-		DynamoDBEndpoint: d.Get("dynamodb_endpoint").(string),
-		KinesisEndpoint:  d.Get("kinesis_endpoint").(string),
-		Insecure:         d.Get("insecure").(bool),
+		AccessKey:               d.Get("access_key").(string),
+		SecretKey:               d.Get("secret_key").(string),
+		Profile:                 d.Get("profile").(string),
+		CredsFilename:           d.Get("shared_credentials_file").(string),
+		Token:                   d.Get("token").(string),
+		Region:                  d.Get("region").(string),
+		MaxRetries:              d.Get("max_retries").(int),
+		RetryBaseDelayMs:        d.Get("retry_base_delay_ms").(int),
+		RetryMaxDelayMs:         d.Get("retry_max_delay_ms").(int),
+		Insecure:                d.Get("insecure").(bool),
+		CustomCABundle:          d.Get("custom_ca_bundle").(string),
+		HTTPProxy:               d.Get("http_proxy").(string),
+		AuditLogPath:            d.Get("audit_log_path").(string),
+		SkipRegionValidation:    d.Get("skip_region_validation").(bool),
+		SkipCredsValidation:     d.Get("skip_credentials_validation").(bool),
+		SkipMetadataApiCheck:    d.Get("skip_metadata_api_check").(bool),
+		SkipRequestingAccountId: d.Get("skip_requesting_account_id").(bool),
+	}
+
+	// dynamodb_endpoint and kinesis_endpoint predate the endpoints block and
+	// are only used when the block doesn't set the same service
+	config.Endpoints = map[string]string{
+		"dynamodb": d.Get("dynamodb_endpoint").(string),
+		"kinesis":  d.Get("kinesis_endpoint").(string),
 	}
 
 	endpointsSet := d.Get("endpoints").(*schema.Set)
 
 	for _, endpointsSetI := range endpointsSet.List() {
 		endpoints := endpointsSetI.(map[string]interface{})
-		config.IamEndpoint = endpoints["iam"].(string)
-		config.Ec2Endpoint = endpoints["ec2"].(string)
-		config.ElbEndpoint = endpoints["elb"].(string)
+		for _, service := range endpointServiceNames {
+			if endpoint := endpoints[service].(string); endpoint != "" {
+				config.Endpoints[service] = endpoint
+			}
+		}
+	}
+
+	assumeRoleSet := d.Get("assume_role").(*schema.Set)
+
+	for _, assumeRoleSetI := range assumeRoleSet.List() {
+		assumeRole := assumeRoleSetI.(map[string]interface{})
+		config.AssumeRoleARN = assumeRole["role_arn"].(string)
+		config.AssumeRoleSessionName = assumeRole["session_name"].(string)
+		config.AssumeRoleExternalID = assumeRole["external_id"].(string)
+		config.AssumeRoleDurationSeconds = assumeRole["duration_seconds"].(int)
+		config.AssumeRolePolicy = assumeRole["policy"].(string)
+	}
+
+	config.DefaultTags = make(map[string]string)
+
+	for _, defaultTagsI := range d.Get("default_tags").([]interface{}) {
+		if defaultTagsI == nil {
+			continue
+		}
+		defaultTags := defaultTagsI.(map[string]interface{})
+		for key, value := range defaultTags["tags"].(map[string]interface{}) {
+			config.DefaultTags[key] = value.(string)
+		}
+	}
+
+	for _, pattern := range d.Get("protected_resource_patterns").([]interface{}) {
+		config.ProtectedResourcePatterns = append(config.ProtectedResourcePatterns, pattern.(string))
+	}
+
+	config.RateLimits = make(map[string]RateLimit)
+
+	for _, rateLimitI := range d.Get("rate_limit").([]interface{}) {
+		rateLimit := rateLimitI.(map[string]interface{})
+		config.RateLimits[rateLimit["service"].(string)] = RateLimit{
+			RequestsPerSecond: rateLimit["requests_per_second"].(float64),
+			Burst:             rateLimit["burst"].(int),
+		}
 	}
 
 	if v, ok := d.GetOk("allowed_account_ids"); ok {
@@ -206,44 +404,181 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 // This is a global MutexKV for use within this plugin.
 var awsMutexKV = mutexkv.NewMutexKV()
 
+// endpointServiceNames lists the services whose endpoint can be overridden
+// in the endpoints block, one for each service client in AWSClient.
+var endpointServiceNames = []string{
+	"apigateway",
+	"autoscaling",
+	"cloudformation",
+	"cloudfront",
+	"cloudtrail",
+	"cloudwatch",
+	"cloudwatchevents",
+	"cloudwatchlogs",
+	"codecommit",
+	"codedeploy",
+	"directoryservice",
+	"dynamodb",
+	"ec2",
+	"ecr",
+	"ecs",
+	"efs",
+	"elasticache",
+	"elasticbeanstalk",
+	"elasticsearch",
+	"elb",
+	"firehose",
+	"glacier",
+	"iam",
+	"kinesis",
+	"kms",
+	"lambda",
+	"opsworks",
+	"rds",
+	"redshift",
+	"route53",
+	"s3",
+	"sns",
+	"sqs",
+	"sts",
+}
+
 func endpointsSchema() *schema.Schema {
+	endpointsAttributes := make(map[string]*schema.Schema)
+
+	for _, service := range endpointServiceNames {
+		endpointsAttributes[service] = &schema.Schema{
+			Type:        schema.TypeString,
+			Optional:    true,
+			Default:     "",
+			Description: descriptions["endpoint"],
+		}
+	}
+
 	return &schema.Schema{
 		Type:     schema.TypeSet,
 		Optional: true,
+		Elem: &schema.Resource{
+			Schema: endpointsAttributes,
+		},
+		Set: endpointsToHash,
+	}
+}
+
+func endpointsToHash(v interface{}) int {
+	var buf bytes.Buffer
+	m := v.(map[string]interface{})
+	for _, service := range endpointServiceNames {
+		buf.WriteString(fmt.Sprintf("%s-", m[service].(string)))
+	}
+
+	return hashcode.String(buf.String())
+}
+
+func rateLimitSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"service": &schema.Schema{
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validateEndpointServiceName,
+					Description:  descriptions["rate_limit_service"],
+				},
+
+				"requests_per_second": &schema.Schema{
+					Type:         schema.TypeFloat,
+					Required:     true,
+					ValidateFunc: validateRequestsPerSecond,
+					Description:  descriptions["rate_limit_requests_per_second"],
+				},
+
+				"burst": &schema.Schema{
+					Type:        schema.TypeInt,
+					Optional:    true,
+					Default:     0,
+					Description: descriptions["rate_limit_burst"],
+				},
+			},
+		},
+	}
+}
+
+func validateEndpointServiceName(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	for _, service := range endpointServiceNames {
+		if value == service {
+			return
+		}
+	}
+
+	errors = append(errors, fmt.Errorf("%q must be one of %s", k, strings.Join(endpointServiceNames, ", ")))
+	return
+}
+
+func validateRequestsPerSecond(v interface{}, k string) (ws []string, errors []error) {
+	if v.(float64) <= 0 {
+		errors = append(errors, fmt.Errorf("%q must be greater than 0", k))
+	}
+	return
+}
+
+func assumeRoleSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		MaxItems: 1,
 		Elem: &schema.Resource{
 			Schema: map[string]*schema.Schema{
-				"iam": &schema.Schema{
+				"role_arn": &schema.Schema{
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: descriptions["assume_role_role_arn"],
+				},
+
+				"session_name": &schema.Schema{
 					Type:        schema.TypeString,
 					Optional:    true,
 					Default:     "",
-					Description: descriptions["iam_endpoint"],
+					Description: descriptions["assume_role_session_name"],
 				},
 
-				"ec2": &schema.Schema{
+				"external_id": &schema.Schema{
 					Type:        schema.TypeString,
 					Optional:    true,
 					Default:     "",
-					Description: descriptions["ec2_endpoint"],
+					Description: descriptions["assume_role_external_id"],
+				},
+
+				"duration_seconds": &schema.Schema{
+					Type:        schema.TypeInt,
+					Optional:    true,
+					Default:     0,
+					Description: descriptions["assume_role_duration_seconds"],
 				},
 
-				"elb": &schema.Schema{
+				"policy": &schema.Schema{
 					Type:        schema.TypeString,
 					Optional:    true,
 					Default:     "",
-					Description: descriptions["elb_endpoint"],
+					Description: descriptions["assume_role_policy"],
 				},
 			},
 		},
-		Set: endpointsToHash,
+		Set: assumeRoleToHash,
 	}
 }
 
-func endpointsToHash(v interface{}) int {
+func assumeRoleToHash(v interface{}) int {
 	var buf bytes.Buffer
 	m := v.(map[string]interface{})
-	buf.WriteString(fmt.Sprintf("%s-", m["iam"].(string)))
-	buf.WriteString(fmt.Sprintf("%s-", m["ec2"].(string)))
-	buf.WriteString(fmt.Sprintf("%s-", m["elb"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["role_arn"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["session_name"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["external_id"].(string)))
+	buf.WriteString(fmt.Sprintf("%d-", m["duration_seconds"].(int)))
+	buf.WriteString(fmt.Sprintf("%s-", m["policy"].(string)))
 
 	return hashcode.String(buf.String())
 }
@@ -0,0 +1,211 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/dashsoftaps/tf-custom-resources/fakeaws"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func init() {
+	defaultWaitMinTimeout = 10 * time.Millisecond
+}
+
+func TestProvider(t *testing.T) {
+	if err := Provider().(*schema.Provider).InternalValidate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestProvider_impl(t *testing.T) {
+	var _ terraform.ResourceProvider = Provider()
+}
+
+// With skip_credentials_validation, an endpoint without STS leaves the
+// provider without the account ID, rather than failing it.
+func TestAccProvider_skipCredentialsValidation(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	noSTS := httptest.NewServer(http.NotFoundHandler())
+	defer noSTS.Close()
+
+	config := testAccConfigProvider(server, "  skip_credentials_validation = true", testAccDashsoftAwsIamGroupConfig, "test", "/")
+	config = regexp.MustCompile(`(?m)^(\s*sts\s*=\s*)".*"$`).ReplaceAllString(config, fmt.Sprintf("${1}%q", noSTS.URL))
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsIamGroupDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsIamGroupExists(provider, "dashsoftaws_iam_group.test", &iam.Group{}),
+					func(_ *terraform.State) error {
+						if accountID := testAccClient(provider).accountid; accountID != "" {
+							return fmt.Errorf("Expected no account ID, got %s", accountID)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+// testAccFakeAWS starts a fake AWS backend for a resource.Test case, and
+// returns it with the provider to test, and the providers of the test case.
+// The resource.Test cases run against the fake rather than an AWS account, so
+// they don't need TF_ACC. The server must be closed once the test is over.
+func testAccFakeAWS() (*fakeaws.Server, *schema.Provider, map[string]terraform.ResourceProvider) {
+	server := fakeaws.NewServer()
+	provider := Provider().(*schema.Provider)
+	return server, provider, map[string]terraform.ResourceProvider{
+		"dashsoftaws": provider,
+	}
+}
+
+// testAccConfig returns the configuration of a test step: the provider block
+// pointing at the fake backend, followed by the resources.
+func testAccConfig(server *fakeaws.Server, resources string, args ...interface{}) string {
+	return server.ProviderConfig() + "\n" + fmt.Sprintf(resources, args...)
+}
+
+// testAccConfigProvider returns the configuration of a test step like
+// testAccConfig, with more arguments in the provider block.
+func testAccConfigProvider(server *fakeaws.Server, providerArgs, resources string, args ...interface{}) string {
+	return strings.Replace(testAccConfig(server, resources, args...),
+		"provider \"dashsoftaws\" {\n", "provider \"dashsoftaws\" {\n"+providerArgs+"\n", 1)
+}
+
+// testAccClient returns the client of the configured provider.
+func testAccClient(provider *schema.Provider) *AWSClient {
+	return provider.Meta().(*AWSClient)
+}
+
+// testAccCheckResourceExists checks that the resource is in the state, and
+// passes its ID to the given check of the resource on the fake backend.
+func testAccCheckResourceExists(name string, check func(id string) error) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("No ID is set for %s", name)
+		}
+		return check(rs.Primary.ID)
+	}
+}
+
+// testAccCheckResourcesDestroyed returns a CheckDestroy checking, with the
+// given check, that every resource of the given type in the state is gone.
+func testAccCheckResourcesDestroyed(resourceType string, check func(id string, attributes map[string]string) error) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		for _, rs := range s.RootModule().Resources {
+			if rs.Type != resourceType {
+				continue
+			}
+			if err := check(rs.Primary.ID, rs.Primary.Attributes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// testAccImportStep returns an import step that also imports the resource
+// through the provider and verifies the imported state in its check. A step
+// needs the Config holding the provider block, and Terraform 0.9 runs a step
+// with a Config as a plan and apply, leaving ImportState to later versions.
+func testAccImportStep(provider *schema.Provider, step resource.TestStep) resource.TestStep {
+	step.Check = testAccCheckImportStateVerify(provider, step.ResourceName, func(rs *terraform.ResourceState) string {
+		if step.ImportStateId != "" {
+			return step.ImportStateId
+		}
+		return step.ImportStateIdPrefix + rs.Primary.ID
+	}, step.ImportStateVerifyIgnore...)
+	return step
+}
+
+// testAccCheckImportStateVerify imports the resource by the ID importID
+// returns for it, reads it and compares the result with the state, like
+// ImportStateVerify does.
+func testAccCheckImportStateVerify(provider *schema.Provider, name string, importID func(*terraform.ResourceState) string, ignore ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+		id := importID(rs)
+
+		info := &terraform.InstanceInfo{Id: name, Type: rs.Type}
+		imported, err := provider.ImportState(info, id)
+		if err != nil {
+			return fmt.Errorf("Error importing %s as %q: %s", name, id, err)
+		}
+		for _, is := range imported {
+			if is.ID != rs.Primary.ID {
+				continue
+			}
+			is, err := provider.Refresh(info, is)
+			if err != nil {
+				return fmt.Errorf("Error reading imported %s: %s", name, err)
+			}
+			if is == nil {
+				return fmt.Errorf("Imported %s is gone once read", name)
+			}
+
+			actual := testAccImportStateAttributes(is.Attributes, ignore)
+			expected := testAccImportStateAttributes(rs.Primary.Attributes, ignore)
+			for k, v := range expected {
+				if actual[k] != v {
+					return fmt.Errorf("Imported %s has %s = %q, expected %q", name, k, actual[k], v)
+				}
+			}
+			for k, v := range actual {
+				if _, ok := expected[k]; !ok {
+					return fmt.Errorf("Imported %s has %s = %q, expected it unset", name, k, v)
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("Importing %s as %q did not import ID %s", name, id, rs.Primary.ID)
+	}
+}
+
+// testAccImportStateAttributes returns the attributes but the ignored ones.
+func testAccImportStateAttributes(attributes map[string]string, ignore []string) map[string]string {
+	kept := make(map[string]string)
+	for k, v := range attributes {
+		ignored := false
+		for _, prefix := range ignore {
+			if strings.HasPrefix(k, prefix) {
+				ignored = true
+			}
+		}
+		if !ignored {
+			kept[k] = v
+		}
+	}
+	return kept
+}
+
+// testAccErrorCode returns the AWS error code of err, or "" if it is not an
+// AWS error.
+func testAccErrorCode(err error) string {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package dashsoftaws
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RateLimit is the client side limit put on the API calls to one service.
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// tokenBucket spreads the API calls to a service made by all resources being
+// applied in parallel, instead of letting them run into the account level
+// throttling of AWS. Calls beyond the burst reserve a token ahead of time and
+// wait until it is due, so waiting calls are served in order.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+
+	return &tokenBucket{
+		rate:   limit.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait before it may be used.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// signHandler returns a named handler delaying every attempt of a request,
+// retries included, until the bucket allows it. It runs first thing when the
+// attempt is signed, so the signature isn't aged by the wait, and an error
+// set here stops the attempt before anything is sent. A request whose context
+// ends while waiting fails with the error of the context.
+func (b *tokenBucket) signHandler(service string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "dashsoftaws.RateLimitHandler",
+		Fn: func(r *request.Request) {
+			wait := b.reserve()
+			if wait <= 0 {
+				return
+			}
+
+			log.Printf("[DEBUG] Rate limiting %s.%s for %s", service, r.Operation.Name, wait)
+			select {
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				r.Error = awserr.New(request.CanceledErrorCode, "request context canceled while rate limited", r.Context().Err())
+			}
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// importRegionRegexp matches the @region suffix an import ID can end with to
+// import a resource from another region than the one of the provider.
+var importRegionRegexp = regexp.MustCompile(`@([a-z]{2}(-[a-z]+)+-\d+)$`)
+
+// withRegion adds the region attribute to a resource, and runs its
+// functions with the client of that region. Without the attribute, the
+// resource lives in the region of the provider, which is then recorded in
+// the state, so changing the region of the provider later doesn't lose
+// track of it.
+func withRegion(r *schema.Resource) *schema.Resource {
+	r.Schema["region"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Computed:    true,
+		ForceNew:    true,
+		Description: "The region of the resource, if not the region of the provider.",
+	}
+
+	if r.Create != nil {
+		r.Create = inRegion(r.Create)
+	}
+	if r.Read != nil {
+		r.Read = inRegion(r.Read)
+	}
+	if r.Update != nil {
+		r.Update = inRegion(r.Update)
+	}
+	if r.Delete != nil {
+		r.Delete = inRegion(r.Delete)
+	}
+	if r.Importer != nil && r.Importer.State != nil {
+		r.Importer.State = importInRegion(r.Importer.State)
+	}
+
+	return r
+}
+
+// inRegion wraps a create, read, update or delete function to pass it the
+// client of the region of the resource as meta.
+func inRegion(f func(*schema.ResourceData, interface{}) error) func(*schema.ResourceData, interface{}) error {
+	return func(d *schema.ResourceData, meta interface{}) error {
+		client, err := meta.(*AWSClient).regionClient(d.Get("region").(string))
+		if err != nil {
+			return err
+		}
+
+		if err := f(d, client); err != nil {
+			return err
+		}
+
+		if d.Id() != "" {
+			d.Set("region", client.region)
+		}
+		return nil
+	}
+}
+
+// importInRegion wraps an importer to take the region from an @region suffix
+// of the import ID, e.g. my-table@eu-west-1.
+func importInRegion(f schema.StateFunc) schema.StateFunc {
+	return func(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+		region := ""
+		if m := importRegionRegexp.FindStringSubmatch(d.Id()); m != nil {
+			region = m[1]
+			d.SetId(strings.TrimSuffix(d.Id(), m[0]))
+		}
+
+		client, err := meta.(*AWSClient).regionClient(region)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Set("region", client.region)
+		return f(d, client)
+	}
+}
+
+// regionClient returns the client for the given region, which is the client
+// itself for its own region or no region. Clients for other regions share the
+// credentials, endpoints, audit log and settings of the provider and are
+// built once, on first use; each of them gets its own rate limits, as AWS
+// throttles every region on its own.
+func (c *AWSClient) regionClient(region string) (*AWSClient, error) {
+	if region == "" || region == c.region {
+		return c, nil
+	}
+
+	c.regionsLock.Lock()
+	defer c.regionsLock.Unlock()
+
+	if client, ok := c.regions[region]; ok {
+		return client, nil
+	}
+
+	if !c.config.SkipRegionValidation {
+		if err := validateRegion(region); err != nil {
+			return nil, err
+		}
+	}
+
+	if partition := partitionForRegion(region); partition != c.partition && !c.config.SkipRegionValidation {
+		return nil, fmt.Errorf("Region %s is in the %s partition, the provider is configured for %s", region, partition, c.partition)
+	}
+
+	log.Printf("[INFO] Initializing AWS client for region %s", region)
+	client := &AWSClient{
+		config:            c.config,
+		session:           c.session.Copy(&aws.Config{Region: aws.String(region)}),
+		region:            region,
+		partition:         c.partition,
+		accountid:         c.accountid,
+		callerArn:         c.callerArn,
+		conns:             make(map[string]interface{}),
+		rateLimiters:      make(map[string]*tokenBucket),
+		auditLog:          c.auditLog,
+		protectedPatterns: c.protectedPatterns,
+	}
+	for service, limit := range c.config.RateLimits {
+		client.rateLimiters[service] = newTokenBucket(limit)
+	}
+
+	if c.regions == nil {
+		c.regions = make(map[string]*AWSClient)
+	}
+	c.regions[region] = client
+	return client, nil
+}
@@ -4,18 +4,33 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/apigateway"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
+// apiGatewayNoBasePath is the base path API Gateway gives to the mapping of
+// the root of a domain name.
+const apiGatewayNoBasePath = "(none)"
+
 func resourceDashsoftAwsApiGatewayBasePathMapping() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceDashsoftAwsApiGatewayBasePathMappingCreate,
 		Read:   resourceDashsoftAwsApiGatewayBasePathMappingRead,
 		Update: resourceDashsoftAwsApiGatewayBasePathMappingUpdate,
 		Delete: resourceDashsoftAwsApiGatewayBasePathMappingDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"domainname": &schema.Schema{
@@ -40,12 +55,12 @@ func resourceDashsoftAwsApiGatewayBasePathMapping() *schema.Resource {
 }
 
 func resourceDashsoftAwsApiGatewayBasePathMappingCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	domainName := d.Get("domainname").(string)
 	restApiId := d.Get("restapiid").(string)
 
-	log.Printf("[DEBUG] Creating API Gateway Base Path Mapping for Domain %s with RestApi Id %&s", domainName, restApiId)
+	log.Printf("[DEBUG] Creating API Gateway Base Path Mapping for Domain %s with RestApi Id %s", domainName, restApiId)
 
 	input := &apigateway.CreateBasePathMappingInput{
 		DomainName: aws.String(domainName),
@@ -60,9 +75,12 @@ func resourceDashsoftAwsApiGatewayBasePathMappingCreate(d *schema.ResourceData,
 		input.BasePath = aws.String(v.(string))
 	}
 
-	out, err := conn.CreateBasePathMapping(input)
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	out, err := conn.CreateBasePathMappingWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("Error creating API Gateway Base Path Mapping: %s", err)
+		return awsError("dashsoftaws_api_gateway_base_path_mapping", domainName, "CreateBasePathMapping", err)
 	}
 	log.Printf("[DEBUG] API Gateway Base Path Mapping created")
 
@@ -71,7 +89,7 @@ func resourceDashsoftAwsApiGatewayBasePathMappingCreate(d *schema.ResourceData,
 }
 
 func resourceDashsoftAwsApiGatewayBasePathMappingRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	domainName, basePath := resourceDashsoftAwsApiGatewayBasePathMappingParseId(d.Id())
 
@@ -81,24 +99,34 @@ func resourceDashsoftAwsApiGatewayBasePathMappingRead(d *schema.ResourceData, me
 		DomainName: aws.String(domainName),
 	})
 	if err != nil {
-		return err
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotFoundException" {
+			log.Printf("[WARN] API Gateway Base Path Mapping %s not found, removing from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_api_gateway_base_path_mapping", d.Id(), "GetBasePathMapping", err)
 	}
 	log.Printf("[DEBUG] Received API Gateway Base Path Mapping %s for domain %s", *out.BasePath, domainName)
 
-	if v, ok := d.GetOk("basepath"); ok {
-		d.Set("basepath", aws.String(v.(string)))
+	// The mapping of the root of the domain has no base path in the
+	// configuration
+	if *out.BasePath == apiGatewayNoBasePath {
+		d.Set("basepath", "")
 	} else {
-		d.Set("basepath", aws.String(""))
+		d.Set("basepath", *out.BasePath)
 	}
+	d.Set("domainname", domainName)
+	d.Set("restapiid", out.RestApiId)
+	d.Set("stage", out.Stage)
 
 	d.SetId(fmt.Sprintf("%s:%s", domainName, *out.BasePath))
 	return nil
 }
 
 func resourceDashsoftAwsApiGatewayBasePathMappingUpdate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
-	originalBasePath, originalDomainName := resourceDashsoftAwsApiGatewayBasePathMappingParseId(d.Id())
+	originalDomainName, originalBasePath := resourceDashsoftAwsApiGatewayBasePathMappingParseId(d.Id())
 	var patchOperations []*apigateway.PatchOperation
 
 	d.Partial(true)
@@ -131,14 +159,17 @@ func resourceDashsoftAwsApiGatewayBasePathMappingUpdate(d *schema.ResourceData,
 	}
 
 	if len(patchOperations) > 0 {
-		resp, err := conn.UpdateBasePathMapping(&apigateway.UpdateBasePathMappingInput{
+		ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+		defer cancel()
+
+		resp, err := conn.UpdateBasePathMappingWithContext(ctx, &apigateway.UpdateBasePathMappingInput{
 			BasePath:        &originalBasePath,
 			DomainName:      &originalDomainName,
 			PatchOperations: patchOperations,
 		})
 
 		if err != nil {
-			return fmt.Errorf("Error updating BasePathMapping %s", err)
+			return awsError("dashsoftaws_api_gateway_base_path_mapping", d.Id(), "UpdateBasePathMapping", err)
 		}
 
 		d.SetId(fmt.Sprintf("%s:%s", originalDomainName, *resp.BasePath))
@@ -149,17 +180,20 @@ func resourceDashsoftAwsApiGatewayBasePathMappingUpdate(d *schema.ResourceData,
 }
 
 func resourceDashsoftAwsApiGatewayBasePathMappingDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	log.Printf("[DEBUG] Deleting API Gateway Base Path Mapping %s", d.Id())
 
 	domainName, basePath := resourceDashsoftAwsApiGatewayBasePathMappingParseId(d.Id())
-	_, err := conn.DeleteBasePathMapping(&apigateway.DeleteBasePathMappingInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	_, err := conn.DeleteBasePathMappingWithContext(ctx, &apigateway.DeleteBasePathMappingInput{
 		BasePath:   aws.String(basePath),
 		DomainName: aws.String(domainName),
 	})
 	if err != nil {
-		return fmt.Errorf("Error deleting API Gateway Base Path Mapping: %s", err)
+		return awsError("dashsoftaws_api_gateway_base_path_mapping", d.Id(), "DeleteBasePathMapping", err)
 	}
 	log.Println("[INFO] API Gateway Base Path Mapping deleted")
 
@@ -169,7 +203,13 @@ func resourceDashsoftAwsApiGatewayBasePathMappingDelete(d *schema.ResourceData,
 	return nil
 }
 
+// resourceDashsoftAwsApiGatewayBasePathMappingParseId splits an ID of the
+// form domain:basepath, which is also the format of terraform import. The
+// mapping of the root of the domain has the base path (none).
 func resourceDashsoftAwsApiGatewayBasePathMappingParseId(id string) (string, string) {
 	parts := strings.SplitN(id, ":", 2)
+	if len(parts) < 2 || parts[1] == "" {
+		return parts[0], apiGatewayNoBasePath
+	}
 	return parts[0], parts[1]
 }
@@ -1,10 +1,11 @@
 package dashsoftaws
 
 import (
-	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/apigateway"
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -15,6 +16,15 @@ func resourceDashsoftAwsApiGatewayClientCertificate() *schema.Resource {
 		Read:   resourceDashsoftAwsApiGatewayClientCertificateRead,
 		Update: resourceDashsoftAwsApiGatewayClientCertificateUpdate,
 		Delete: resourceDashsoftAwsApiGatewayClientCertificateDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"description": &schema.Schema{
@@ -26,12 +36,14 @@ func resourceDashsoftAwsApiGatewayClientCertificate() *schema.Resource {
 				Optional: true,
 				Computed: true,
 			},
+			"tags":     tagsSchema(),
+			"tags_all": tagsAllSchema(),
 		},
 	}
 }
 
 func resourceDashsoftAwsApiGatewayClientCertificateCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	log.Printf("[DEBUG] Creating API Gateway Client Certificate")
 
@@ -41,40 +53,48 @@ func resourceDashsoftAwsApiGatewayClientCertificateCreate(d *schema.ResourceData
 		input.Description = aws.String(v.(string))
 	}
 
-	out, err := conn.GenerateClientCertificate(input)
+	if tags := wantedTags(d, meta); len(tags) > 0 {
+		input.Tags = aws.StringMap(tags)
+	}
+
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	out, err := conn.GenerateClientCertificateWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("Error generating API Gateway Client Certificate: %s", err)
+		return awsError("dashsoftaws_api_gateway_client_certificate", "", "GenerateClientCertificate", err)
 	}
 	log.Printf("[DEBUG] API Gateway Client Certificate %s generated", *out.ClientCertificateId)
 
 	d.SetId(*out.ClientCertificateId)
-	resourceDashsoftAwsApiGatewayClientCertificateRead(d, meta)
-
-	return nil
+	return resourceDashsoftAwsApiGatewayClientCertificateRead(d, meta)
 }
 
 func resourceDashsoftAwsApiGatewayClientCertificateRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	log.Printf("[DEBUG] Reading API Gateway Client Certificate ID %s", d.Id())
 	out, err := conn.GetClientCertificate(&apigateway.GetClientCertificateInput{
 		ClientCertificateId: aws.String(d.Id()),
 	})
 	if err != nil {
-		return err
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotFoundException" {
+			log.Printf("[WARN] API Gateway Client Certificate %s not found, removing from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_api_gateway_client_certificate", d.Id(), "GetClientCertificate", err)
 	}
-	log.Printf("[DEBUG] Received API Gateway Client Certificate with description: %s", out.Description)
+	log.Printf("[DEBUG] Received API Gateway Client Certificate with description: %s", aws.StringValue(out.Description))
 
 	d.SetId(*out.ClientCertificateId)
-	if out.Description != nil {
-		d.Set("description", *out.Description)
-	}
+	d.Set("description", out.Description)
 	d.Set("certificatebody", *out.PemEncodedCertificate)
-	return nil
+	return setTags(d, meta, aws.StringValueMap(out.Tags))
 }
 
 func resourceDashsoftAwsApiGatewayClientCertificateUpdate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	var patchOperations []*apigateway.PatchOperation
 
@@ -90,33 +110,47 @@ func resourceDashsoftAwsApiGatewayClientCertificateUpdate(d *schema.ResourceData
 	}
 
 	if len(patchOperations) > 0 {
-		resp, err := conn.UpdateClientCertificate(&apigateway.UpdateClientCertificateInput{
+		ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+		defer cancel()
+
+		resp, err := conn.UpdateClientCertificateWithContext(ctx, &apigateway.UpdateClientCertificateInput{
 			ClientCertificateId: aws.String(d.Id()),
 			PatchOperations:     patchOperations,
 		})
 
 		if err != nil {
-			return fmt.Errorf("Error updating ClientCertificate %s", err)
+			return awsError("dashsoftaws_api_gateway_client_certificate", d.Id(), "UpdateClientCertificate", err)
 		}
 
 		d.SetId(*resp.ClientCertificateId)
 	}
 
+	if d.HasChange("tags") {
+		arn := apigatewayArn(meta, "/clientcertificates/"+d.Id())
+		if err := updateTags(d, meta, "dashsoftaws_api_gateway_client_certificate", apigatewayTagger(conn, arn)); err != nil {
+			return err
+		}
+		d.SetPartial("tags")
+	}
+
 	d.Partial(false)
 	return resourceDashsoftAwsApiGatewayClientCertificateRead(d, meta)
 }
 
 func resourceDashsoftAwsApiGatewayClientCertificateDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	log.Printf("[DEBUG] Deleting API Gateway Client Certificate %s", d.Id())
 
 	ClientCertificateId := d.Id()
-	_, err := conn.DeleteClientCertificate(&apigateway.DeleteClientCertificateInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	_, err := conn.DeleteClientCertificateWithContext(ctx, &apigateway.DeleteClientCertificateInput{
 		ClientCertificateId: aws.String(ClientCertificateId),
 	})
 	if err != nil {
-		return fmt.Errorf("Error deleting API Gateway Client Certificate: %s", err)
+		return awsError("dashsoftaws_api_gateway_client_certificate", ClientCertificateId, "DeleteClientCertificate", err)
 	}
 	log.Println("[INFO] API Gateway Client Certificate deleted")
 
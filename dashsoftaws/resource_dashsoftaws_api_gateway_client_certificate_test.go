@@ -0,0 +1,98 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsApiGatewayClientCertificate_basic(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	var cert apigateway.ClientCertificate
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsApiGatewayClientCertificateDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsApiGatewayClientCertificateConfig, "Created by Terraform", "blue"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsApiGatewayClientCertificateExists(provider, "dashsoftaws_api_gateway_client_certificate.test", &cert),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_client_certificate.test", "description", "Created by Terraform"),
+					resource.TestCheckResourceAttrSet("dashsoftaws_api_gateway_client_certificate.test", "certificatebody"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_client_certificate.test", "tags.%", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_client_certificate.test", "tags.color", "blue"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsApiGatewayClientCertificateConfig, "Updated by Terraform", "green"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsApiGatewayClientCertificateExists(provider, "dashsoftaws_api_gateway_client_certificate.test", &cert),
+					testAccCheckDashsoftAwsApiGatewayClientCertificateDescription(&cert, "Updated by Terraform"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_client_certificate.test", "description", "Updated by Terraform"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_client_certificate.test", "tags.color", "green"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				Config:            testAccConfig(server, testAccDashsoftAwsApiGatewayClientCertificateConfig, "Updated by Terraform", "green"),
+				ResourceName:      "dashsoftaws_api_gateway_client_certificate.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+			}),
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsApiGatewayClientCertificateExists(provider *schema.Provider, name string, cert *apigateway.ClientCertificate) resource.TestCheckFunc {
+	return testAccCheckResourceExists(name, func(id string) error {
+		out, err := testAccClient(provider).apigatewayconn().GetClientCertificate(&apigateway.GetClientCertificateInput{
+			ClientCertificateId: aws.String(id),
+		})
+		if err != nil {
+			return err
+		}
+		*cert = *out
+		return nil
+	})
+}
+
+func testAccCheckDashsoftAwsApiGatewayClientCertificateDescription(cert *apigateway.ClientCertificate, description string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		if aws.StringValue(cert.Description) != description {
+			return fmt.Errorf("Expected description %q, got %q", description, aws.StringValue(cert.Description))
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsApiGatewayClientCertificateDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_api_gateway_client_certificate", func(id string, _ map[string]string) error {
+		_, err := testAccClient(provider).apigatewayconn().GetClientCertificate(&apigateway.GetClientCertificateInput{
+			ClientCertificateId: aws.String(id),
+		})
+		if err == nil {
+			return fmt.Errorf("API Gateway Client Certificate %s still exists", id)
+		}
+		if testAccErrorCode(err) != "NotFoundException" {
+			return err
+		}
+		return nil
+	})
+}
+
+const testAccDashsoftAwsApiGatewayClientCertificateConfig = `
+resource "dashsoftaws_api_gateway_client_certificate" "test" {
+  description = %q
+
+  tags {
+    color = %q
+  }
+}
+`
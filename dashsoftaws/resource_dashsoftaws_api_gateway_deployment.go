@@ -3,8 +3,10 @@ package dashsoftaws
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/apigateway"
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -15,6 +17,15 @@ func resourceDashsoftAwsApiGatewayDeployment() *schema.Resource {
 		Read:   resourceDashsoftAwsApiGatewayDeploymentRead,
 		Update: resourceDashsoftAwsApiGatewayDeploymentUpdate,
 		Delete: resourceDashsoftAwsApiGatewayDeploymentDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceDashsoftAwsApiGatewayDeploymentImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"restapiid": &schema.Schema{
@@ -33,6 +44,7 @@ func resourceDashsoftAwsApiGatewayDeployment() *schema.Resource {
 			"cacheclustersize": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
 			},
 			"stage_name": &schema.Schema{
 				Type:     schema.TypeString,
@@ -64,17 +76,21 @@ func resourceDashsoftAwsApiGatewayDeployment() *schema.Resource {
 			"burstlimit": &schema.Schema{
 				Type:     schema.TypeInt,
 				Optional: true,
+				Computed: true,
 			},
 			"ratelimit": &schema.Schema{
 				Type:     schema.TypeInt,
 				Optional: true,
+				Computed: true,
 			},
+			"tags":     tagsSchema(),
+			"tags_all": tagsAllSchema(),
 		},
 	}
 }
 
 func resourceDashsoftAwsApiGatewayDeploymentCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	restApiId := d.Get("restapiid").(string)
 	stageName := d.Get("stage_name").(string)
@@ -106,9 +122,12 @@ func resourceDashsoftAwsApiGatewayDeploymentCreate(d *schema.ResourceData, meta
 
 	log.Printf("[DEBUG] Creating API Gateway Deployment with Stage %s", stageName)
 
-	deployment, err := conn.CreateDeployment(input)
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	deployment, err := conn.CreateDeploymentWithContext(ctx, input)
 	if err != nil {
-		return err
+		return awsError("dashsoftaws_api_gateway_deployment", restApiId, "CreateDeployment", err)
 	}
 	log.Printf("[DEBUG] API Gateway Deployment %s created", *deployment.Id)
 
@@ -156,158 +175,249 @@ func resourceDashsoftAwsApiGatewayDeploymentCreate(d *schema.ResourceData, meta
 	}
 
 	if len(patchOperations) > 0 {
-		conn.UpdateStage(&apigateway.UpdateStageInput{
+		_, err = conn.UpdateStageWithContext(ctx, &apigateway.UpdateStageInput{
 			RestApiId:       aws.String(restApiId),
 			StageName:       aws.String(stageName),
 			PatchOperations: patchOperations,
 		})
 
 		if err != nil {
-			return fmt.Errorf("Error updating Stage %s: %s", stageName, err)
+			return awsError("dashsoftaws_api_gateway_deployment", *deployment.Id, "UpdateStage", err)
 		}
 	}
 
 	d.SetId(*deployment.Id)
 
-	resourceDashsoftAwsApiGatewayDeploymentRead(d, meta)
-	return nil
+	// Deployments can't be tagged, the tags go to the stage
+	if tags := wantedTags(d, meta); len(tags) > 0 {
+		_, err = conn.TagResourceWithContext(ctx, &apigateway.TagResourceInput{
+			ResourceArn: aws.String(apigatewayStageArn(meta, restApiId, stageName)),
+			Tags:        aws.StringMap(tags),
+		})
+		if err != nil {
+			return awsError("dashsoftaws_api_gateway_deployment", d.Id(), "TagResource", err)
+		}
+	}
+
+	return resourceDashsoftAwsApiGatewayDeploymentRead(d, meta)
 }
 
 func resourceDashsoftAwsApiGatewayDeploymentRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
+
+	restApiId := d.Get("restapiid").(string)
+	stageName := d.Get("stage_name").(string)
 
 	log.Printf("[DEBUG] Reading API Gateway Deployment ID %s", d.Id())
 
 	out, err := conn.GetDeployment(&apigateway.GetDeploymentInput{
 		DeploymentId: aws.String(d.Id()),
-		RestApiId:    aws.String(d.Get("restapiid").(string)),
+		RestApiId:    aws.String(restApiId),
 	})
-
 	if err != nil {
-		return err
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotFoundException" {
+			log.Printf("[WARN] API Gateway Deployment %s not found, removing from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_api_gateway_deployment", d.Id(), "GetDeployment", err)
 	}
 
 	if out.Description != nil {
 		d.Set("description", *out.Description)
 	}
 
+	// The stage is created along with the deployment, so it is read as part of
+	// this resource
+	stage, err := conn.GetStage(&apigateway.GetStageInput{
+		RestApiId: aws.String(restApiId),
+		StageName: aws.String(stageName),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotFoundException" {
+			log.Printf("[WARN] API Gateway Stage %s of Deployment %s not found, removing from state", stageName, d.Id())
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_api_gateway_deployment", d.Id(), "GetStage", err)
+	}
+
+	d.Set("stagedescription", stage.Description)
+	d.Set("cacheclusterenabled", stage.CacheClusterEnabled)
+	d.Set("cacheclustersize", stage.CacheClusterSize)
+	d.Set("clientcertificateid", stage.ClientCertificateId)
+	if err := d.Set("variables", pointersMapToStringList(stage.Variables)); err != nil {
+		return err
+	}
+
+	d.Set("cloudwatchlogsloglevel", "OFF")
+	d.Set("datatrace", false)
+	if settings, ok := stage.MethodSettings["*/*"]; ok {
+		if settings.LoggingLevel != nil {
+			d.Set("cloudwatchlogsloglevel", *settings.LoggingLevel)
+		}
+		if settings.DataTraceEnabled != nil {
+			d.Set("datatrace", *settings.DataTraceEnabled)
+		}
+		if settings.ThrottlingBurstLimit != nil {
+			d.Set("burstlimit", int(*settings.ThrottlingBurstLimit))
+		}
+		if settings.ThrottlingRateLimit != nil {
+			d.Set("ratelimit", int(*settings.ThrottlingRateLimit))
+		}
+	}
+
 	d.SetId(*out.Id)
-	return nil
+	return setTags(d, meta, aws.StringValueMap(stage.Tags))
 }
 
 func resourceDashsoftAwsApiGatewayDeploymentUpdate(d *schema.ResourceData, meta interface{}) error {
-	//this update method doesn't work as it should
-	//The stages should probarly be split into its own resource, that then relies on the api deployment
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
-	var patchOperations []*apigateway.PatchOperation
+	restApiId := d.Get("restapiid").(string)
+	stageName := d.Get("stage_name").(string)
 
-	d.Partial(true)
+	ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+	defer cancel()
 
-	if d.HasChange("burstlimit") {
-		d.SetPartial("burstlimit")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/*/*/throttling/burstLimit"),
-			Value: aws.String(d.Get("burstlimit").(string)),
-		})
-	}
-
-	if d.HasChange("ratelimit") {
-		d.SetPartial("ratelimit")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/*/*/throttling/rateLimit"),
-			Value: aws.String(d.Get("ratelimit").(string)),
-		})
-	}
-
-	if d.HasChange("cloudwatchlogsloglevel") {
-		d.SetPartial("cloudwatchlogsloglevel")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/*/*/logging/loglevel"),
-			Value: aws.String(d.Get("cloudwatchlogsloglevel").(string)),
-		})
-	}
+	d.Partial(true)
 
-	if d.HasChange("datatrace") {
-		d.SetPartial("datatrace")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/*/*/logging/dataTrace"),
-			Value: aws.String(d.Get("datatrace").(string)),
+	if d.HasChange("description") {
+		_, err := conn.UpdateDeploymentWithContext(ctx, &apigateway.UpdateDeploymentInput{
+			RestApiId:    aws.String(restApiId),
+			DeploymentId: aws.String(d.Id()),
+			PatchOperations: []*apigateway.PatchOperation{
+				&apigateway.PatchOperation{
+					Op:    aws.String(apigateway.OpReplace),
+					Path:  aws.String("/description"),
+					Value: aws.String(d.Get("description").(string)),
+				},
+			},
 		})
+		if err != nil {
+			return awsError("dashsoftaws_api_gateway_deployment", d.Id(), "UpdateDeployment", err)
+		}
+		d.SetPartial("description")
 	}
 
-	if d.HasChange("cacheclusterenabled") {
-		d.SetPartial("cacheclusterenabled")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/CacheClusterEnabled"),
-			Value: aws.String(d.Get("cacheclusterenabled").(string)),
-		})
+	// All the other settings are the ones of the stage
+	stagePaths := map[string]string{
+		"stagedescription":       "/description",
+		"cacheclusterenabled":    "/cacheClusterEnabled",
+		"cacheclustersize":       "/cacheClusterSize",
+		"clientcertificateid":    "/clientCertificateId",
+		"cloudwatchlogsloglevel": "/*/*/logging/loglevel",
+		"datatrace":              "/*/*/logging/dataTrace",
+		"burstlimit":             "/*/*/throttling/burstLimit",
+		"ratelimit":              "/*/*/throttling/rateLimit",
 	}
 
-	if d.HasChange("cacheclustersize") {
-		d.SetPartial("cacheclustersize")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/CacheClusterSize"),
-			Value: aws.String(d.Get("cacheclusterenabled").(string)),
-		})
+	var patchOperations []*apigateway.PatchOperation
+	var changed []string
+
+	for key, path := range stagePaths {
+		if d.HasChange(key) {
+			changed = append(changed, key)
+			patchOperations = append(patchOperations, &apigateway.PatchOperation{
+				Op:    aws.String(apigateway.OpReplace),
+				Path:  aws.String(path),
+				Value: aws.String(fmt.Sprintf("%v", d.Get(key))),
+			})
+		}
 	}
 
-	if d.HasChange("clientcertificateid") {
-		d.SetPartial("clientcertificateid")
-		patchOperations = append(patchOperations, &apigateway.PatchOperation{
-			Op:    aws.String(apigateway.OpReplace),
-			Path:  aws.String("/clientCertificateId"),
-			Value: aws.String(d.Get("clientcertificateid").(string)),
-		})
+	if d.HasChange("variables") {
+		changed = append(changed, "variables")
+		o, n := d.GetChange("variables")
+		oldVariables := o.(map[string]interface{})
+		newVariables := n.(map[string]interface{})
+
+		for name := range oldVariables {
+			if _, ok := newVariables[name]; !ok {
+				patchOperations = append(patchOperations, &apigateway.PatchOperation{
+					Op:   aws.String(apigateway.OpRemove),
+					Path: aws.String("/variables/" + name),
+				})
+			}
+		}
+		for name, value := range newVariables {
+			patchOperations = append(patchOperations, &apigateway.PatchOperation{
+				Op:    aws.String(apigateway.OpReplace),
+				Path:  aws.String("/variables/" + name),
+				Value: aws.String(value.(string)),
+			})
+		}
 	}
 
 	if len(patchOperations) > 0 {
-		resp, err := conn.UpdateDeployment(&apigateway.UpdateDeploymentInput{
-			DeploymentId:    aws.String(d.Id()),
+		_, err := conn.UpdateStageWithContext(ctx, &apigateway.UpdateStageInput{
+			RestApiId:       aws.String(restApiId),
+			StageName:       aws.String(stageName),
 			PatchOperations: patchOperations,
 		})
-
 		if err != nil {
-			return fmt.Errorf("Error updating deployment %s", err)
+			return awsError("dashsoftaws_api_gateway_deployment", d.Id(), "UpdateStage", err)
 		}
 
-		d.SetId(*resp.Id)
+		for _, key := range changed {
+			d.SetPartial(key)
+		}
+	}
+
+	if d.HasChange("tags") {
+		arn := apigatewayStageArn(meta, restApiId, stageName)
+		if err := updateTags(d, meta, "dashsoftaws_api_gateway_deployment", apigatewayTagger(conn, arn)); err != nil {
+			return err
+		}
+		d.SetPartial("tags")
 	}
 
 	d.Partial(false)
 	return resourceDashsoftAwsApiGatewayDeploymentRead(d, meta)
 }
 
+// resourceDashsoftAwsApiGatewayDeploymentImport takes an ID of the form
+// restapiid:deploymentid:stage, as the deployment is only known within its
+// REST API and the resource manages its stage too.
+func resourceDashsoftAwsApiGatewayDeploymentImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts, err := parseImportId(d.Id(), "restapiid:deploymentid:stage")
+	if err != nil {
+		return nil, err
+	}
+
+	d.Set("restapiid", parts[0])
+	d.Set("stage_name", parts[2])
+	d.SetId(parts[1])
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceDashsoftAwsApiGatewayDeploymentDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	restApiId := d.Get("restapiid").(string)
 
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
 	if v, ok := d.GetOk("stage_name"); ok {
 		stageName := v.(string)
 		log.Printf("[DEBUG] Delete stage with name %s (if it still exists)", stageName)
-		_, err := conn.DeleteStage(&apigateway.DeleteStageInput{
+		_, err := conn.DeleteStageWithContext(ctx, &apigateway.DeleteStageInput{
 			RestApiId: aws.String(restApiId),
 			StageName: aws.String(stageName),
 		})
 		if err != nil {
-			log.Printf("[INFO] Ignored error when deleting stage %s", err)
+			log.Printf("[INFO] Ignored error when deleting stage: %s", awsError("dashsoftaws_api_gateway_deployment", d.Id(), "DeleteStage", err))
 		}
 	}
 
 	log.Printf("[DEBUG] Deleting API Gateway Deployment %s", d.Id())
-	_, err := conn.DeleteDeployment(&apigateway.DeleteDeploymentInput{
+	_, err := conn.DeleteDeploymentWithContext(ctx, &apigateway.DeleteDeploymentInput{
 		DeploymentId: aws.String(d.Id()),
 		RestApiId:    aws.String(d.Get("restapiid").(string)),
 	})
 	if err != nil {
-		return fmt.Errorf("Error deleting API Gateway Deployment: %s", err)
+		return awsError("dashsoftaws_api_gateway_deployment", d.Id(), "DeleteDeployment", err)
 	}
 	log.Println("[INFO] API Gateway Deployment deleted")
 
@@ -316,3 +426,7 @@ func resourceDashsoftAwsApiGatewayDeploymentDelete(d *schema.ResourceData, meta
 	log.Printf("[DEBUG] Deleted API Gateway Deployment %s", restApiId)
 	return nil
 }
+
+func apigatewayStageArn(meta interface{}, restApiId string, stageName string) string {
+	return apigatewayArn(meta, fmt.Sprintf("/restapis/%s/stages/%s", restApiId, stageName))
+}
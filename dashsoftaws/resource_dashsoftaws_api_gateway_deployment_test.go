@@ -0,0 +1,176 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsApiGatewayDeployment_basic(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+	server.AddRestAPI("abc123")
+
+	var stage apigateway.Stage
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsApiGatewayDeploymentDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsApiGatewayDeploymentConfig, "First deployment", "v1", "INFO"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsApiGatewayDeploymentExists(provider, "dashsoftaws_api_gateway_deployment.test", &stage),
+					testAccCheckDashsoftAwsApiGatewayDeploymentStageVariable(&stage, "version", "v1"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "description", "First deployment"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "stagedescription", "Test stage"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "variables.version", "v1"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "cloudwatchlogsloglevel", "INFO"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "tags.color", "blue"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsApiGatewayDeploymentConfig, "Second deployment", "v2", "ERROR"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsApiGatewayDeploymentExists(provider, "dashsoftaws_api_gateway_deployment.test", &stage),
+					testAccCheckDashsoftAwsApiGatewayDeploymentStageVariable(&stage, "version", "v2"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "description", "Second deployment"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "variables.version", "v2"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "cloudwatchlogsloglevel", "ERROR"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsApiGatewayDeploymentConfigSettings),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsApiGatewayDeploymentExists(provider, "dashsoftaws_api_gateway_deployment.test", &stage),
+					testAccCheckDashsoftAwsApiGatewayDeploymentStageVariable(&stage, "version", ""),
+					testAccCheckDashsoftAwsApiGatewayDeploymentStageVariable(&stage, "color", "green"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "variables.%", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "datatrace", "true"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "burstlimit", "100"),
+					resource.TestCheckResourceAttr("dashsoftaws_api_gateway_deployment.test", "ratelimit", "50"),
+				),
+			},
+			{
+				// The deployment ID is only known once created, so the import
+				// is checked rather than made by an import step
+				Config: testAccConfig(server, testAccDashsoftAwsApiGatewayDeploymentConfigSettings),
+				Check: testAccCheckImportStateVerify(provider, "dashsoftaws_api_gateway_deployment.test", func(rs *terraform.ResourceState) string {
+					return fmt.Sprintf("abc123:%s:test", rs.Primary.ID)
+				}),
+			},
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsApiGatewayDeploymentExists(provider *schema.Provider, name string, stage *apigateway.Stage) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+
+		conn := testAccClient(provider).apigatewayconn()
+		_, err := conn.GetDeployment(&apigateway.GetDeploymentInput{
+			DeploymentId: aws.String(rs.Primary.ID),
+			RestApiId:    aws.String(rs.Primary.Attributes["restapiid"]),
+		})
+		if err != nil {
+			return err
+		}
+
+		out, err := conn.GetStage(&apigateway.GetStageInput{
+			RestApiId: aws.String(rs.Primary.Attributes["restapiid"]),
+			StageName: aws.String(rs.Primary.Attributes["stage_name"]),
+		})
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(out.DeploymentId) != rs.Primary.ID {
+			return fmt.Errorf("Expected stage %s to point at deployment %s, got %s", *out.StageName, rs.Primary.ID, aws.StringValue(out.DeploymentId))
+		}
+		*stage = *out
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsApiGatewayDeploymentStageVariable(stage *apigateway.Stage, name, value string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		if got := aws.StringValue(stage.Variables[name]); got != value {
+			return fmt.Errorf("Expected stage variable %s to be %q, got %q", name, value, got)
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsApiGatewayDeploymentDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_api_gateway_deployment", func(id string, attributes map[string]string) error {
+		conn := testAccClient(provider).apigatewayconn()
+		_, err := conn.GetDeployment(&apigateway.GetDeploymentInput{
+			DeploymentId: aws.String(id),
+			RestApiId:    aws.String(attributes["restapiid"]),
+		})
+		if err == nil {
+			return fmt.Errorf("API Gateway Deployment %s still exists", id)
+		}
+		if testAccErrorCode(err) != "NotFoundException" {
+			return err
+		}
+
+		_, err = conn.GetStage(&apigateway.GetStageInput{
+			RestApiId: aws.String(attributes["restapiid"]),
+			StageName: aws.String(attributes["stage_name"]),
+		})
+		if err == nil {
+			return fmt.Errorf("API Gateway Stage %s still exists", attributes["stage_name"])
+		}
+		if testAccErrorCode(err) != "NotFoundException" {
+			return err
+		}
+		return nil
+	})
+}
+
+const testAccDashsoftAwsApiGatewayDeploymentConfig = `
+resource "dashsoftaws_api_gateway_deployment" "test" {
+  restapiid              = "abc123"
+  stage_name             = "test"
+  description            = %q
+  stagedescription       = "Test stage"
+  cloudwatchlogsloglevel = %[3]q
+
+  variables {
+    version = %[2]q
+  }
+
+  tags {
+    color = "blue"
+  }
+}
+`
+
+const testAccDashsoftAwsApiGatewayDeploymentConfigSettings = `
+resource "dashsoftaws_api_gateway_deployment" "test" {
+  restapiid              = "abc123"
+  stage_name             = "test"
+  description            = "Second deployment"
+  stagedescription       = "Test stage"
+  cloudwatchlogsloglevel = "ERROR"
+  datatrace              = true
+  burstlimit             = 100
+  ratelimit              = 50
+
+  variables {
+    color = "green"
+  }
+
+  tags {
+    color = "blue"
+  }
+}
+`
@@ -1,10 +1,11 @@
 package dashsoftaws
 
 import (
-	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/apigateway"
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -13,7 +14,17 @@ func resourceDashsoftAwsApiGatewayDomainName() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceDashsoftAwsApiGatewayDomainNameCreate,
 		Read:   resourceDashsoftAwsApiGatewayDomainNameRead,
+		Update: resourceDashsoftAwsApiGatewayDomainNameUpdate,
 		Delete: resourceDashsoftAwsApiGatewayDomainNameDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"domainname": &schema.Schema{
@@ -27,80 +38,114 @@ func resourceDashsoftAwsApiGatewayDomainName() *schema.Resource {
 				ForceNew: true,
 			},
 			"certificateprivatekey": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				DiffSuppressFunc: suppressImportedCertificate,
 			},
 			"certificatebody": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				DiffSuppressFunc: suppressImportedCertificate,
 			},
 			"certificatechain": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				DiffSuppressFunc: suppressImportedCertificate,
 			},
 			"distributiondomainname": &schema.Schema{
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"tags":     tagsSchema(),
+			"tags_all": tagsAllSchema(),
 		},
 	}
 }
 
 func resourceDashsoftAwsApiGatewayDomainNameCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	domainName := d.Get("domainname").(string)
 	log.Printf("[DEBUG] Creating API Gateway Domain Name %s", domainName)
 
-	out, err := conn.CreateDomainName(&apigateway.CreateDomainNameInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	input := &apigateway.CreateDomainNameInput{
 		CertificateChain:      aws.String(d.Get("certificatechain").(string)),
 		CertificateBody:       aws.String(d.Get("certificatebody").(string)),
 		CertificateName:       aws.String(d.Get("certificatename").(string)),
 		CertificatePrivateKey: aws.String(d.Get("certificateprivatekey").(string)),
 		DomainName:            aws.String(domainName),
-	})
+	}
+	if tags := wantedTags(d, meta); len(tags) > 0 {
+		input.Tags = aws.StringMap(tags)
+	}
+
+	out, err := conn.CreateDomainNameWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("Error creating API Gateway Domain Name: %s", err)
+		return awsError("dashsoftaws_api_gateway_domain_name", domainName, "CreateDomainName", err)
 	}
 	log.Printf("[DEBUG] API Gateway Domain Name %s created with DistributionDomainName %s", *out.DomainName, *out.DistributionDomainName)
 
 	d.SetId(*out.DomainName)
-	resourceDashsoftAwsApiGatewayDomainNameRead(d, meta)
-
-	return nil
+	return resourceDashsoftAwsApiGatewayDomainNameRead(d, meta)
 }
 
 func resourceDashsoftAwsApiGatewayDomainNameRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	log.Printf("[DEBUG] Reading API Gateway Domain Name ID %s", d.Id())
 	out, err := conn.GetDomainName(&apigateway.GetDomainNameInput{
 		DomainName: aws.String(d.Id()),
 	})
 	if err != nil {
-		return fmt.Errorf("Error reading API Gateway Domain Name: %s", err)
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotFoundException" {
+			log.Printf("[WARN] API Gateway Domain Name %s not found, removing from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_api_gateway_domain_name", d.Id(), "GetDomainName", err)
 	}
 	log.Printf("[DEBUG] API Gateway Domain Name %s created with DistributionDomainName %s", *out.DomainName, *out.DistributionDomainName)
 
 	d.SetId(*out.DomainName)
+	d.Set("domainname", out.DomainName)
+	d.Set("certificatename", out.CertificateName)
 	d.Set("distributiondomainname", *out.DistributionDomainName)
-	return nil
+	return setTags(d, meta, aws.StringValueMap(out.Tags))
+}
+
+func resourceDashsoftAwsApiGatewayDomainNameUpdate(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*AWSClient).apigatewayconn()
+
+	if d.HasChange("tags") {
+		arn := apigatewayArn(meta, "/domainnames/"+d.Id())
+		if err := updateTags(d, meta, "dashsoftaws_api_gateway_domain_name", apigatewayTagger(conn, arn)); err != nil {
+			return err
+		}
+	}
+
+	return resourceDashsoftAwsApiGatewayDomainNameRead(d, meta)
 }
 
 func resourceDashsoftAwsApiGatewayDomainNameDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).apigateway
+	conn := meta.(*AWSClient).apigatewayconn()
 
 	log.Printf("[DEBUG] Deleting API Gateway Domain Name %s", d.Id())
 
 	DomainNameId := d.Id()
-	_, err := conn.DeleteDomainName(&apigateway.DeleteDomainNameInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	_, err := conn.DeleteDomainNameWithContext(ctx, &apigateway.DeleteDomainNameInput{
 		DomainName: aws.String(d.Id()),
 	})
 	if err != nil {
-		return fmt.Errorf("Error deleting API Gateway Domain Name: %s", err)
+		return awsError("dashsoftaws_api_gateway_domain_name", d.Id(), "DeleteDomainName", err)
 	}
 	log.Println("[INFO] API Gateway Domain Name deleted")
 	d.SetId("")
@@ -108,3 +153,10 @@ func resourceDashsoftAwsApiGatewayDomainNameDelete(d *schema.ResourceData, meta
 	log.Printf("[DEBUG] Deleted API Gateway Domain Name %s", DomainNameId)
 	return nil
 }
+
+// suppressImportedCertificate ignores the certificate of an imported domain
+// name, which API Gateway does not return, so it is missing from the state
+// rather than changed.
+func suppressImportedCertificate(k, old, new string, d *schema.ResourceData) bool {
+	return old == "" && d.Id() != ""
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"strings"
 	"time"
 
@@ -20,18 +19,21 @@ import (
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
-// Number of times to retry if a throttling- or test message exception occurs
-const CLOUDWATCH_LOG_SUBSCRIPTION_FILTER_MAX_THROTTLE_RETRIES = 30
-
-// How long to sleep when a throttle-event happens
-const CLOUDWATCH_LOG_SUBSCRIPTION_FILTER_THROTTLE_SLEEP_MILLISECONDS = 2000
-
 func resourceDashsoftAwsCloudwatchLogSubscriptionFilter() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceDashsoftAwsCloudwatchLogSubscriptionFilterCreate,
 		Read:   resourceDashsoftAwsCloudwatchLogSubscriptionFilterRead,
 		Update: resourceDashsoftAwsCloudwatchLogSubscriptionFilterUpdate,
 		Delete: resourceDashsoftAwsCloudwatchLogSubscriptionFilterDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceDashsoftAwsCloudwatchLogSubscriptionFilterImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": &schema.Schema{
@@ -64,66 +66,53 @@ func resourceDashsoftAwsCloudwatchLogSubscriptionFilter() *schema.Resource {
 }
 
 func resourceDashsoftAwsCloudwatchLogSubscriptionFilterCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).cloudwatchlogsconn
+	conn := meta.(*AWSClient).cloudwatchlogsconn()
 
 	name := d.Get("name").(string)
 
 	log_group := d.Get("log_group_name").(string)
 
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
 	destination := d.Get("destination_arn").(string)
-	if strings.HasPrefix(destination, "arn:aws:kinesis:") {
+	if arnService(destination) == "kinesis" {
 		destination_arn_sliced := strings.Split(destination, "/")
 		destination_name := destination_arn_sliced[len(destination_arn_sliced)-1]
 
-		kinesis_conn := meta.(*AWSClient).kinesisconn
-		waitForKinesisStreamToActivate(kinesis_conn, destination_name)
+		kinesis_conn := meta.(*AWSClient).kinesisconn()
+		if err := waitForKinesisStreamToActivate(ctx, kinesis_conn, destination_name); err != nil {
+			return err
+		}
 	}
 
-	params := getAwsCloudWatchLogsSubscriptionFilterInput(d)
-	sleep_randomizer := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if arnService(destination) == "lambda" {
+		err := addPermissionsToLambdaFunction(d, meta)
+		if err != nil {
+			return err
+		}
+	}
 
-	log.Printf("[DEBUG] Creating SubscriptionFilter %#v", params)
+	params := getAwsCloudWatchLogsSubscriptionFilterInput(d)
 
-	attemptCount := 1
-	for attemptCount <= CLOUDWATCH_LOG_SUBSCRIPTION_FILTER_MAX_THROTTLE_RETRIES {
-		// Since the add permissions have a tendency to fail, we put the code in side.
-		if strings.HasPrefix(destination, "arn:aws:lambda") {
-			err := addPermissionsToLambdaFunction(d, meta)
-			if err != nil {
-				return err
-			}
-		}
+	log.Printf("[DEBUG] Creating SubscriptionFilter %s", params)
 
-		_, err := conn.PutSubscriptionFilter(&params)
-		attemptCount += 1
-		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
-				if awsErr.Code() == "InvalidParameterException" {
-					log.Printf("[DEBUG] Caught message: \"%s\", code: \"%s\". Attempt %d/%d: Sleeping for a bit to throttle back put request",
-						awsErr.Message(), awsErr.Code(), attemptCount-1, CLOUDWATCH_LOG_SUBSCRIPTION_FILTER_MAX_THROTTLE_RETRIES)
-					// random delay 100-200% of THROTTLE_SLEEP
-					time.Sleep(time.Duration(CLOUDWATCH_LOG_SUBSCRIPTION_FILTER_THROTTLE_SLEEP_MILLISECONDS+sleep_randomizer.Intn(CLOUDWATCH_LOG_SUBSCRIPTION_FILTER_THROTTLE_SLEEP_MILLISECONDS/2)) * time.Millisecond)
-				} else {
-					// Some other non-retryable exception occurred
-					return fmt.Errorf("[WARN] Error creating SubscriptionFilter (%s) for LogGroup (%s) to destination (%s), message: \"%s\", code: \"%s\"",
-						name, log_group, destination, awsErr.Message(), awsErr.Code())
-				}
-			} else {
-				// Non-AWS exception occurred, give up
-				return fmt.Errorf("Error creating Cloudwatch logs subscription filter %s: %#v", name, err)
-			}
-		} else {
-			d.SetId(cloudwatchLogSubscriptionFilterId(d.Get("log_group_name").(string)))
-			return resourceDashsoftAwsCloudwatchLogSubscriptionFilterRead(d, meta)
-		}
+	// The test message PutSubscriptionFilter sends fails with an
+	// InvalidParameterException saying it could not be delivered until the
+	// destination and its permissions have propagated, which the retryer of
+	// the session retries; other invalid parameters fail right away
+	_, err := conn.PutSubscriptionFilterWithContext(ctx, &params)
+	if err != nil {
+		return awsError("dashsoftaws_cloudwatch_log_subscription_filter", log_group+":"+name, "PutSubscriptionFilter", err)
 	}
 
-	// Too many throttling events occurred, give up
-	return fmt.Errorf("Unable to create Cloudwatch logs subscription filter '%s' after %d attempts", name, attemptCount)
+	d.SetId(cloudwatchLogSubscriptionFilterId(d.Get("log_group_name").(string)))
+	return resourceDashsoftAwsCloudwatchLogSubscriptionFilterRead(d, meta)
 }
 
 func addPermissionsToLambdaFunction(d *schema.ResourceData, meta interface{}) error {
-	lambda_conn := meta.(*AWSClient).lambdaconn
+	lambda_conn := meta.(*AWSClient).lambdaconn()
+	partition := meta.(*AWSClient).partition
 
 	name := d.Get("name").(string)
 	log_group := d.Get("log_group_name").(string)
@@ -141,7 +130,7 @@ func addPermissionsToLambdaFunction(d *schema.ResourceData, meta interface{}) er
 		region := lambda_arn_sliced[3]
 		accountid := lambda_arn_sliced[4]
 		principal := fmt.Sprintf("logs.%s.amazonaws.com", region)
-		source_arn := fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", region, accountid, log_group)
+		source_arn := fmt.Sprintf("arn:%s:logs:%s:%s:log-group:%s:*", partition, region, accountid, log_group)
 
 		params := &lambda.AddPermissionInput{
 			Action:        aws.String("lambda:InvokeFunction"),
@@ -152,18 +141,13 @@ func addPermissionsToLambdaFunction(d *schema.ResourceData, meta interface{}) er
 			SourceAccount: aws.String(accountid),
 		}
 
-		log.Printf("[DEBUG] Attempting: to do add-access with params \"%#v\"", params)
+		log.Printf("[DEBUG] Attempting: to do add-access with params %s", params)
 		_, err := lambda_conn.AddPermission(params)
 		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
-				if awsErr.Code() == "ResourceConflictException" {
-					log.Printf("[DEBUG] Got a ResourceConflictException, but that is ok. Function=%s, log_group=%s", function_name, log_group)
-				} else {
-					return fmt.Errorf("[WARN] Error doing add-access for LogGroup (%s) to lambda (%s), message: \"%s\", code: \"%s\"",
-						log_group, destination, awsErr.Message(), awsErr.Code())
-				}
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ResourceConflictException" {
+				log.Printf("[DEBUG] Got a ResourceConflictException, but that is ok. Function=%s, log_group=%s", function_name, log_group)
 			} else {
-				return fmt.Errorf("Error creating Cloudwatch logs subscription filter %s: %#v", name, err)
+				return awsError("dashsoftaws_cloudwatch_log_subscription_filter", log_group+":"+name, "AddPermission", err)
 			}
 		}
 	}
@@ -171,18 +155,17 @@ func addPermissionsToLambdaFunction(d *schema.ResourceData, meta interface{}) er
 }
 
 func resourceDashsoftAwsCloudwatchLogSubscriptionFilterUpdate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).cloudwatchlogsconn
+	conn := meta.(*AWSClient).cloudwatchlogsconn()
 
 	params := getAwsCloudWatchLogsSubscriptionFilterInput(d)
 
-	log.Printf("[DEBUG] Update SubscriptionFilter %#v", params)
-	_, err := conn.PutSubscriptionFilter(&params)
+	ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+	defer cancel()
+
+	log.Printf("[DEBUG] Update SubscriptionFilter %s", params)
+	_, err := conn.PutSubscriptionFilterWithContext(ctx, &params)
 	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			return fmt.Errorf("[WARN] Error updating SubscriptionFilter (%s) for LogGroup (%s), message: \"%s\", code: \"%s\"",
-				d.Get("name").(string), d.Get("log_group_name").(string), awsErr.Message(), awsErr.Code())
-		}
-		return err
+		return awsError("dashsoftaws_cloudwatch_log_subscription_filter", d.Get("log_group_name").(string)+":"+d.Get("name").(string), "PutSubscriptionFilter", err)
 	}
 
 	d.SetId(cloudwatchLogSubscriptionFilterId(d.Get("log_group_name").(string)))
@@ -210,7 +193,7 @@ func getAwsCloudWatchLogsSubscriptionFilterInput(d *schema.ResourceData) cloudwa
 }
 
 func resourceDashsoftAwsCloudwatchLogSubscriptionFilterRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).cloudwatchlogsconn
+	conn := meta.(*AWSClient).cloudwatchlogsconn()
 
 	log_group := d.Get("log_group_name").(string)
 	name := d.Get("name").(string) // "name" is a required field in the schema
@@ -220,31 +203,66 @@ func resourceDashsoftAwsCloudwatchLogSubscriptionFilterRead(d *schema.ResourceDa
 		FilterNamePrefix: aws.String(name),
 	}
 
-	resp, err := conn.DescribeSubscriptionFilters(req)
+	var found *cloudwatchlogs.SubscriptionFilter
+	err := conn.DescribeSubscriptionFiltersPages(req, func(page *cloudwatchlogs.DescribeSubscriptionFiltersOutput, lastPage bool) bool {
+		for _, subscriptionFilter := range page.SubscriptionFilters {
+			if *subscriptionFilter.LogGroupName == log_group && *subscriptionFilter.FilterName == name {
+				found = subscriptionFilter
+				return false
+			}
+		}
+		return true
+	})
 	if err != nil {
-		return fmt.Errorf("Error reading SubscriptionFilters for log group %s with name prefix %s: %#v", log_group, d.Get("name").(string), err)
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ResourceNotFoundException" {
+			log.Printf("[WARN] Log group %s not found, removing SubscriptionFilter %s from state", log_group, name)
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_cloudwatch_log_subscription_filter", log_group+":"+name, "DescribeSubscriptionFilters", err)
 	}
 
-	for _, subscriptionFilter := range resp.SubscriptionFilters {
-		if *subscriptionFilter.LogGroupName == log_group {
-			d.SetId(cloudwatchLogSubscriptionFilterId(log_group))
-			return nil // OK, matching subscription filter found
-		}
+	if found != nil {
+		d.SetId(cloudwatchLogSubscriptionFilterId(log_group))
+		d.Set("destination_arn", found.DestinationArn)
+		d.Set("filter_pattern", found.FilterPattern)
+		d.Set("role_arn", found.RoleArn)
+		return nil // OK, matching subscription filter found
 	}
 
-	return fmt.Errorf("Subscription filter for log group %s with name prefix %s not found!", log_group, d.Get("name").(string))
+	log.Printf("[WARN] SubscriptionFilter %s for log group %s not found, removing from state", name, log_group)
+	d.SetId("")
+	return nil
+}
+
+// resourceDashsoftAwsCloudwatchLogSubscriptionFilterImport takes an ID of
+// the form loggroup:filtername, as the ID of the resource is only derived
+// from the log group.
+func resourceDashsoftAwsCloudwatchLogSubscriptionFilterImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts, err := parseImportId(d.Id(), "loggroup:filtername")
+	if err != nil {
+		return nil, err
+	}
+
+	d.Set("log_group_name", parts[0])
+	d.Set("name", parts[1])
+	d.SetId(cloudwatchLogSubscriptionFilterId(parts[0]))
+	return []*schema.ResourceData{d}, nil
 }
 
 func resourceDashsoftAwsCloudwatchLogSubscriptionFilterDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).cloudwatchlogsconn
+	conn := meta.(*AWSClient).cloudwatchlogsconn()
 
 	log_group := d.Get("log_group_name").(string)
 	name := d.Get("name").(string)
 	destination := d.Get("destination_arn").(string)
 
-	if strings.HasPrefix(destination, "arn:aws:lambda") {
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	if arnService(destination) == "lambda" {
 		// access permissions should also be cleaned up
-		lambda_conn := meta.(*AWSClient).lambdaconn
+		lambda_conn := meta.(*AWSClient).lambdaconn()
 
 		lambda_arn_sliced := strings.Split(destination, ":")
 		function_name := lambda_arn_sliced[len(lambda_arn_sliced)-1]
@@ -255,17 +273,13 @@ func resourceDashsoftAwsCloudwatchLogSubscriptionFilterDelete(d *schema.Resource
 		}
 
 		if permissionExists(function_name, statement_id, lambda_conn) {
-			_, err := lambda_conn.RemovePermission(&lambda.RemovePermissionInput{
+			_, err := lambda_conn.RemovePermissionWithContext(ctx, &lambda.RemovePermissionInput{
 				FunctionName: aws.String(function_name),
 				StatementId:  aws.String(statement_id),
 			})
 			if err != nil {
-				if awsErr, ok := err.(awserr.Error); ok {
-					log.Printf("[WARN] Error removing the access permission SID (%s) for lambda function (%s), message: \"%s\", code: \"%s\"",
-						statement_id, function_name, awsErr.Message(), awsErr.Code())
-				} else {
-					log.Printf("[WARN] Error removing the access permission from lambda function %s: %#v", function_name, err)
-				}
+				log.Printf("[WARN] Error removing the access permission SID %s: %s",
+					statement_id, awsError("dashsoftaws_cloudwatch_log_subscription_filter", log_group+":"+name, "RemovePermission", err))
 			}
 		}
 	}
@@ -274,45 +288,41 @@ func resourceDashsoftAwsCloudwatchLogSubscriptionFilterDelete(d *schema.Resource
 		FilterName:   aws.String(name),      // Required
 		LogGroupName: aws.String(log_group), // Required
 	}
-	_, err := conn.DeleteSubscriptionFilter(params)
+	_, err := conn.DeleteSubscriptionFilterWithContext(ctx, params)
 
 	if err != nil {
-		return fmt.Errorf(
-			"Error deleting Subscription Filter from log group: %s with name filter name %s", log_group, name)
+		return awsError("dashsoftaws_cloudwatch_log_subscription_filter", log_group+":"+name, "DeleteSubscriptionFilter", err)
 	}
 	d.SetId("")
 	return nil
 }
 
-func waitForKinesisStreamToActivate(conn *kinesis.Kinesis, stream_name string) error {
+func waitForKinesisStreamToActivate(ctx aws.Context, conn *kinesis.Kinesis, stream_name string) error {
 	// If destination is Kinesis stream, then it must be ACTIVE before creating SubscriptionFilter
-	wait := resource.StateChangeConf{
+	_, err := waitForState(fmt.Sprintf("Kinesis stream %s to become ACTIVE", stream_name), &resource.StateChangeConf{
 		Pending:    []string{"CREATING", "UPDATING", "DELETING"},
 		Target:     []string{"ACTIVE"},
-		Timeout:    5 * time.Minute,
+		Timeout:    remainingTimeout(ctx),
 		MinTimeout: 1 * time.Second,
 		Refresh: func() (interface{}, string, error) {
 			log.Printf("[DEBUG] Checking if Kinesis stream %s is ACTIVE", stream_name)
-			resp, err := conn.DescribeStream(&kinesis.DescribeStreamInput{
+			resp, err := conn.DescribeStreamWithContext(ctx, &kinesis.DescribeStreamInput{
 				StreamName: aws.String(stream_name),
 			})
 			if err != nil {
-				return resp, "FAILED", err
+				return resp, "FAILED", awsError("dashsoftaws_cloudwatch_log_subscription_filter", stream_name, "DescribeStream", err)
 			}
 			stream_status := *resp.StreamDescription.StreamStatus
 			log.Printf("[DEBUG] Kinesis stream %s is %s checking for ACTIVE", stream_name, stream_status)
 			return resp, stream_status, nil
 		},
-	}
-
-	_, err := wait.WaitForState()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	})
+	return err
 }
 
+// permissionExists looks for the statement in the resource policy of the
+// function. GetPolicy returns the whole policy at once, so unlike the list
+// calls there are no pages to follow.
 func permissionExists(function_name string, statementid string, lambda_conn *lambda.Lambda) bool {
 
 	resp, err := lambda_conn.GetPolicy(&lambda.GetPolicyInput{
@@ -327,7 +337,7 @@ func permissionExists(function_name string, statementid string, lambda_conn *lam
 	}
 
 	if err != nil {
-		log.Printf("[DEBUG] GetPolicy returns \"%#v\" - maybe no access permissions exists?", err)
+		log.Printf("[DEBUG] GetPolicy returns %s - maybe no access permissions exists?", err)
 		return false
 	} else {
 		dec := json.NewDecoder(strings.NewReader(*resp.Policy))
@@ -336,8 +346,8 @@ func permissionExists(function_name string, statementid string, lambda_conn *lam
 			if err := dec.Decode(&m); err == io.EOF {
 				break
 			} else if err != nil {
-				log.Printf("[DEBUG] Decoding access policy failed \"%#v\"", resp.Policy)
-				log.Fatal(err)
+				log.Printf("[WARN] Decoding access policy of function %s failed: %s", function_name, err)
+				return false
 			}
 
 			for _, statement := range m.Statement {
@@ -0,0 +1,158 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsCloudwatchLogSubscriptionFilter_kinesis(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+	server.AddLogGroup("/aws/test")
+	streamArn := server.AddKinesisStream("test")
+
+	var filter cloudwatchlogs.SubscriptionFilter
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsCloudwatchLogSubscriptionFilterConfig, streamArn, "ERROR"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterExists(provider, "dashsoftaws_cloudwatch_log_subscription_filter.test", &filter),
+					resource.TestCheckResourceAttr("dashsoftaws_cloudwatch_log_subscription_filter.test", "id", cloudwatchLogSubscriptionFilterId("/aws/test")),
+					resource.TestCheckResourceAttr("dashsoftaws_cloudwatch_log_subscription_filter.test", "destination_arn", streamArn),
+					resource.TestCheckResourceAttr("dashsoftaws_cloudwatch_log_subscription_filter.test", "filter_pattern", "ERROR"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsCloudwatchLogSubscriptionFilterConfig, streamArn, "WARN"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterExists(provider, "dashsoftaws_cloudwatch_log_subscription_filter.test", &filter),
+					testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterPattern(&filter, "WARN"),
+					resource.TestCheckResourceAttr("dashsoftaws_cloudwatch_log_subscription_filter.test", "filter_pattern", "WARN"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				Config:            testAccConfig(server, testAccDashsoftAwsCloudwatchLogSubscriptionFilterConfig, streamArn, "WARN"),
+				ResourceName:      "dashsoftaws_cloudwatch_log_subscription_filter.test",
+				ImportState:       true,
+				ImportStateId:     "/aws/test:test",
+				ImportStateVerify: true,
+			}),
+		},
+	})
+}
+
+func TestAccDashsoftAwsCloudwatchLogSubscriptionFilter_lambda(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+	server.AddLogGroup("/aws/test")
+	functionArn := server.AddLambdaFunction("test")
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: providers,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterDestroy(provider),
+			testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterPermission(provider, "test", "/aws/test", false),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsCloudwatchLogSubscriptionFilterConfig, functionArn, "ERROR"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterExists(provider, "dashsoftaws_cloudwatch_log_subscription_filter.test", &cloudwatchlogs.SubscriptionFilter{}),
+					testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterPermission(provider, "test", "/aws/test", true),
+					resource.TestCheckResourceAttr("dashsoftaws_cloudwatch_log_subscription_filter.test", "destination_arn", functionArn),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterExists(provider *schema.Provider, name string, filter *cloudwatchlogs.SubscriptionFilter) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+
+		found, err := testAccFindSubscriptionFilter(provider, rs.Primary.Attributes["log_group_name"], rs.Primary.Attributes["name"])
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			return fmt.Errorf("SubscriptionFilter %s not found", rs.Primary.Attributes["name"])
+		}
+		*filter = *found
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterPattern(filter *cloudwatchlogs.SubscriptionFilter, pattern string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		if aws.StringValue(filter.FilterPattern) != pattern {
+			return fmt.Errorf("Expected filter pattern %q, got %q", pattern, aws.StringValue(filter.FilterPattern))
+		}
+		return nil
+	}
+}
+
+// testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterPermission checks
+// whether the function lets CloudWatch Logs invoke it for the log group.
+func testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterPermission(provider *schema.Provider, function, logGroup string, exists bool) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		statementId, err := lambdaPermissionStatementId(logGroup, function)
+		if err != nil {
+			return err
+		}
+		if permissionExists(function, statementId, testAccClient(provider).lambdaconn()) != exists {
+			return fmt.Errorf("Expected permission %s of function %s to exist: %t", statementId, function, exists)
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsCloudwatchLogSubscriptionFilterDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_cloudwatch_log_subscription_filter", func(id string, attributes map[string]string) error {
+		found, err := testAccFindSubscriptionFilter(provider, attributes["log_group_name"], attributes["name"])
+		if err != nil {
+			return err
+		}
+		if found != nil {
+			return fmt.Errorf("SubscriptionFilter %s still exists", attributes["name"])
+		}
+		return nil
+	})
+}
+
+func testAccFindSubscriptionFilter(provider *schema.Provider, logGroup, name string) (*cloudwatchlogs.SubscriptionFilter, error) {
+	out, err := testAccClient(provider).cloudwatchlogsconn().DescribeSubscriptionFilters(&cloudwatchlogs.DescribeSubscriptionFiltersInput{
+		LogGroupName:     aws.String(logGroup),
+		FilterNamePrefix: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range out.SubscriptionFilters {
+		if aws.StringValue(filter.FilterName) == name {
+			return filter, nil
+		}
+	}
+	return nil, nil
+}
+
+const testAccDashsoftAwsCloudwatchLogSubscriptionFilterConfig = `
+resource "dashsoftaws_cloudwatch_log_subscription_filter" "test" {
+  name            = "test"
+  log_group_name  = "/aws/test"
+  destination_arn = %q
+  filter_pattern  = %q
+}
+`
@@ -16,15 +16,6 @@ import (
 	"github.com/hashicorp/terraform/helper/hashcode"
 )
 
-// Number of times to retry if a throttling-related exception occurs
-const DYNAMODB_MAX_THROTTLE_RETRIES = 5
-
-// How long to sleep when a throttle-event happens
-const DYNAMODB_THROTTLE_SLEEP = 5 * time.Second
-
-// How long to sleep if a limit-exceeded event happens
-const DYNAMODB_LIMIT_EXCEEDED_SLEEP = 10 * time.Second
-
 // A number of these are marked as computed because if you don't
 // provide a value, DynamoDB will provide you with defaults (which are the
 // default values specified below)
@@ -34,6 +25,15 @@ func resourceDashsoftAwsDynamodbTable() *schema.Resource {
 		Read:   resourceDashsoftAwsDynamoDbTableRead,
 		Update: resourceDashsoftAwsDynamoDbTableUpdate,
 		Delete: resourceDashsoftAwsDynamoDbTableDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"arn": &schema.Schema{
@@ -183,12 +183,14 @@ func resourceDashsoftAwsDynamodbTable() *schema.Resource {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"tags":     tagsSchema(),
+			"tags_all": tagsAllSchema(),
 		},
 	}
 }
 
 func resourceDashsoftAwsDynamoDbTableCreate(d *schema.ResourceData, meta interface{}) error {
-	dynamodbconn := meta.(*AWSClient).dynamodbconn
+	dynamodbconn := meta.(*AWSClient).dynamodbconn()
 
 	name := d.Get("name").(string)
 
@@ -301,40 +303,30 @@ func resourceDashsoftAwsDynamoDbTableCreate(d *schema.ResourceData, meta interfa
 		fmt.Printf("[DEBUG] Adding StreamSpecifications to the table")
 	}
 
-	attemptCount := 1
-	for attemptCount <= DYNAMODB_MAX_THROTTLE_RETRIES {
-		output, err := dynamodbconn.CreateTable(req)
-		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
-				if awsErr.Code() == "ThrottlingException" {
-					log.Printf("[DEBUG] Attempt %d/%d: Sleeping for a bit to throttle back create request", attemptCount, DYNAMODB_MAX_THROTTLE_RETRIES)
-					time.Sleep(DYNAMODB_THROTTLE_SLEEP)
-					attemptCount += 1
-				} else if awsErr.Code() == "LimitExceededException" {
-					log.Printf("[DEBUG] Limit on concurrent table creations hit, sleeping for a bit")
-					time.Sleep(DYNAMODB_LIMIT_EXCEEDED_SLEEP)
-					attemptCount += 1
-				} else {
-					// Some other non-retryable exception occurred
-					return fmt.Errorf("AWS Error creating DynamoDB table: %s", err)
-				}
-			} else {
-				// Non-AWS exception occurred, give up
-				return fmt.Errorf("Error creating DynamoDB table: %s", err)
-			}
-		} else {
-			// No error, set ID and return
-			d.SetId(*output.TableDescription.TableName)
-			if err := d.Set("arn", *output.TableDescription.TableArn); err != nil {
-				return err
-			}
+	if tags := wantedTags(d, meta); len(tags) > 0 {
+		req.Tags = dynamodbTags(tags)
+	}
 
-			return resourceDashsoftAwsDynamoDbTableRead(d, meta)
-		}
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	// Throttling and the limit on concurrent table creations are retried by
+	// the retryer of the session
+	output, err := dynamodbconn.CreateTableWithContext(ctx, req)
+	if err != nil {
+		return awsError("dashsoftaws_dynamodb_table", d.Get("name").(string), "CreateTable", err)
+	}
+
+	d.SetId(*output.TableDescription.TableName)
+	if err := d.Set("arn", *output.TableDescription.TableArn); err != nil {
+		return err
 	}
 
-	// Too many throttling events occurred, give up
-	return fmt.Errorf("Unable to create DynamoDB table '%s' after %d attempts", name, attemptCount)
+	if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+		return err
+	}
+
+	return resourceDashsoftAwsDynamoDbTableRead(d, meta)
 }
 
 func getConditionallyScalingCapacity(d *schema.ResourceData, key string) (int, int) {
@@ -355,10 +347,15 @@ func getConditionallyScalingCapacity(d *schema.ResourceData, key string) (int, i
 func resourceDashsoftAwsDynamoDbTableUpdate(d *schema.ResourceData, meta interface{}) error {
 
 	log.Printf("[DEBUG] Updating DynamoDB table %s", d.Id())
-	dynamodbconn := meta.(*AWSClient).dynamodbconn
+	dynamodbconn := meta.(*AWSClient).dynamodbconn()
+
+	ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+	defer cancel()
 
 	// Ensure table is active before trying to update
-	waitForTableToBeActive(d.Id(), meta)
+	if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+		return err
+	}
 
 	// LSI can only be done at create-time, abort if it's been changed
 	if d.HasChange("local_secondary_index") {
@@ -391,12 +388,14 @@ func resourceDashsoftAwsDynamoDbTableUpdate(d *schema.ResourceData, meta interfa
 
 			// Updates for capacity needs to be done before updating
 			// the streamspecification - it cannot be done in the same call
-			_, err := dynamodbconn.UpdateTable(req)
+			_, err := dynamodbconn.UpdateTableWithContext(ctx, req)
 			if err != nil {
-				return err
+				return awsError("dashsoftaws_dynamodb_table", d.Id(), "UpdateTable", err)
 			}
 
-			waitForTableToBeActive(d.Id(), meta)
+			if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -410,13 +409,15 @@ func resourceDashsoftAwsDynamoDbTableUpdate(d *schema.ResourceData, meta interfa
 			StreamViewType: aws.String(d.Get("stream_view_type").(string)),
 		}
 
-		_, err := dynamodbconn.UpdateTable(req)
+		_, err := dynamodbconn.UpdateTableWithContext(ctx, req)
 
 		if err != nil {
-			return err
+			return awsError("dashsoftaws_dynamodb_table", d.Id(), "UpdateTable", err)
 		}
 
-		waitForTableToBeActive(d.Id(), meta)
+		if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+			return err
+		}
 	}
 
 	if d.HasChange("global_secondary_index") {
@@ -492,14 +493,18 @@ func resourceDashsoftAwsDynamoDbTableUpdate(d *schema.ResourceData, meta interfa
 
 				req.AttributeDefinitions = attributes
 				req.GlobalSecondaryIndexUpdates = updates
-				_, err = dynamodbconn.UpdateTable(req)
+				_, err = dynamodbconn.UpdateTableWithContext(ctx, req)
 
 				if err != nil {
-					return err
+					return awsError("dashsoftaws_dynamodb_table", d.Id(), "UpdateTable", err)
 				}
 
-				waitForTableToBeActive(d.Id(), meta)
-				waitForGSIToBeActive(d.Id(), *gsi.IndexName, meta)
+				if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+					return err
+				}
+				if err := waitForGSIToBeActive(ctx, d.Id(), *gsi.IndexName, meta); err != nil {
+					return err
+				}
 
 			}
 		}
@@ -518,13 +523,15 @@ func resourceDashsoftAwsDynamoDbTableUpdate(d *schema.ResourceData, meta interfa
 				updates = append(updates, update)
 
 				req.GlobalSecondaryIndexUpdates = updates
-				_, err := dynamodbconn.UpdateTable(req)
+				_, err := dynamodbconn.UpdateTableWithContext(ctx, req)
 
 				if err != nil {
-					return err
+					return awsError("dashsoftaws_dynamodb_table", d.Id(), "UpdateTable", err)
 				}
 
-				waitForTableToBeActive(d.Id(), meta)
+				if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -542,85 +549,84 @@ func resourceDashsoftAwsDynamoDbTableUpdate(d *schema.ResourceData, meta interfa
 				gsiReadCapacity := int64(gsidata["read_capacity"].(int))
 				only_scale_up := d.Get("only_scale_up").(bool)
 
-				attemptCount := 1
-				for attemptCount <= DYNAMODB_MAX_THROTTLE_RETRIES {
-					attemptCount += 1
-
-					// We can only change throughput, but we need to make sure it actually needs changing
-					tableDescription, err := dynamodbconn.DescribeTable(&dynamodb.DescribeTableInput{
-						TableName: aws.String(d.Id()),
-					})
+				// We can only change throughput, but we need to make sure it actually needs changing
+				tableDescription, err := dynamodbconn.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+					TableName: aws.String(d.Id()),
+				})
 
-					if err != nil {
-						return err
-					}
+				if err != nil {
+					return awsError("dashsoftaws_dynamodb_table", d.Id(), "DescribeTable", err)
+				}
 
-					table := tableDescription.Table
+				table := tableDescription.Table
 
-					updates := []*dynamodb.GlobalSecondaryIndexUpdate{}
+				log.Printf("[DEBUG] Updating GSI %s", gsiName)
+				gsi, err := getGlobalSecondaryIndex(gsiName, table.GlobalSecondaryIndexes)
 
-					log.Printf("[DEBUG] Updating GSI %s", gsiName)
-					gsi, err := getGlobalSecondaryIndex(gsiName, table.GlobalSecondaryIndexes)
+				if err != nil {
+					return err
+				}
 
-					if err != nil {
-						return err
+				provisionedRead := *gsi.ProvisionedThroughput.ReadCapacityUnits
+				provisionedWrite := *gsi.ProvisionedThroughput.WriteCapacityUnits
+				if only_scale_up {
+					if gsiReadCapacity < provisionedRead {
+						gsiReadCapacity = provisionedRead
 					}
-
-					provisionedRead := *gsi.ProvisionedThroughput.ReadCapacityUnits
-					provisionedWrite := *gsi.ProvisionedThroughput.WriteCapacityUnits
-					if only_scale_up {
-						if gsiReadCapacity < provisionedRead {
-							gsiReadCapacity = provisionedRead
-						}
-						if gsiWriteCapacity < provisionedWrite {
-							gsiWriteCapacity = provisionedWrite
-						}
+					if gsiWriteCapacity < provisionedWrite {
+						gsiWriteCapacity = provisionedWrite
 					}
+				}
 
-					// Should we update
-					if gsiReadCapacity != provisionedRead || gsiWriteCapacity != provisionedWrite {
-						update := &dynamodb.GlobalSecondaryIndexUpdate{
+				// Should we update
+				if gsiReadCapacity == provisionedRead && gsiWriteCapacity == provisionedWrite {
+					log.Printf("[DEBUG] GSI %s already at desired capacity. Skipping", gsiName)
+					continue
+				}
+
+				req := &dynamodb.UpdateTableInput{
+					TableName: aws.String(d.Id()),
+					GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+						&dynamodb.GlobalSecondaryIndexUpdate{
 							Update: &dynamodb.UpdateGlobalSecondaryIndexAction{
-								IndexName: aws.String(gsidata["name"].(string)),
+								IndexName: aws.String(gsiName),
 								ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
 									WriteCapacityUnits: aws.Int64(gsiWriteCapacity),
 									ReadCapacityUnits:  aws.Int64(gsiReadCapacity),
 								},
 							},
-						}
-						updates = append(updates, update)
-
-					} else {
-						log.Printf("[DEBUG] GSI %s already at desired capacity. Skipping", gsiName)
-						break
-					}
-
-					if len(updates) > 0 {
-
-						req := &dynamodb.UpdateTableInput{
-							TableName: aws.String(d.Id()),
-						}
+						},
+					},
+				}
 
-						req.GlobalSecondaryIndexUpdates = updates
+				// An index still updating from a previous change is retried by
+				// the retryer of the session
+				log.Printf("[DEBUG] Updating GSI read / write capacity on %s.%s to %v/%v", d.Id(), gsiName, gsiReadCapacity, gsiWriteCapacity)
+				_, err = dynamodbconn.UpdateTableWithContext(ctx, req)
 
-						log.Printf("[DEBUG] Updating GSI read / write capacity on %s.%s to %v/%v", d.Id(), gsiName, gsiReadCapacity, gsiWriteCapacity)
-						_, err := dynamodbconn.UpdateTable(req)
+				if err != nil {
+					log.Printf("[DEBUG] Error updating table: %s", err)
+					return awsError("dashsoftaws_dynamodb_table", d.Id(), "UpdateTable", err)
+				}
 
-						if err != nil {
-							log.Printf("[DEBUG] Error updating table: %s", err)
-							return err
-						}
-					}
+				if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+					return err
 				}
 			}
 		}
 	}
 
+	if d.HasChange("tags") {
+		if err := updateTags(d, meta, "dashsoftaws_dynamodb_table", dynamodbTagger(dynamodbconn, d.Get("arn").(string))); err != nil {
+			return err
+		}
+	}
+
 	return resourceDashsoftAwsDynamoDbTableRead(d, meta)
 }
 
 func resourceDashsoftAwsDynamoDbTableRead(d *schema.ResourceData, meta interface{}) error {
-	dynamodbconn := meta.(*AWSClient).dynamodbconn
+	dynamodbconn := meta.(*AWSClient).dynamodbconn()
 
 	only_scale_up := d.Get("only_scale_up").(bool)
 	log.Printf("[DEBUG] only_scale_up flag read %v", only_scale_up)
@@ -638,11 +644,23 @@ func resourceDashsoftAwsDynamoDbTableRead(d *schema.ResourceData, meta interface
 			d.SetId("")
 			return nil
 		}
-		return err
+		return awsError("dashsoftaws_dynamodb_table", d.Id(), "DescribeTable", err)
 	}
 
 	table := result.Table
 
+	d.Set("name", table.TableName)
+
+	for _, attribute := range table.KeySchema {
+		if *attribute.KeyType == "HASH" {
+			d.Set("hash_key", attribute.AttributeName)
+		}
+
+		if *attribute.KeyType == "RANGE" {
+			d.Set("range_key", attribute.AttributeName)
+		}
+	}
+
 	d.Set("write_capacity", table.ProvisionedThroughput.WriteCapacityUnits)
 	d.Set("read_capacity", table.ProvisionedThroughput.ReadCapacityUnits)
 
@@ -658,6 +676,32 @@ func resourceDashsoftAwsDynamoDbTableRead(d *schema.ResourceData, meta interface
 
 	d.Set("attribute", attributes)
 
+	lsiList := make([]map[string]interface{}, 0, len(table.LocalSecondaryIndexes))
+	for _, lsiObject := range table.LocalSecondaryIndexes {
+		lsi := map[string]interface{}{
+			"name":            *lsiObject.IndexName,
+			"projection_type": *lsiObject.Projection.ProjectionType,
+		}
+
+		for _, attribute := range lsiObject.KeySchema {
+			if *attribute.KeyType == "RANGE" {
+				lsi["range_key"] = *attribute.AttributeName
+			}
+		}
+
+		nonKeyAttrs := make([]string, 0, len(lsiObject.Projection.NonKeyAttributes))
+		for _, nonKeyAttr := range lsiObject.Projection.NonKeyAttributes {
+			nonKeyAttrs = append(nonKeyAttrs, *nonKeyAttr)
+		}
+		lsi["non_key_attributes"] = nonKeyAttrs
+
+		lsiList = append(lsiList, lsi)
+	}
+
+	if err := d.Set("local_secondary_index", lsiList); err != nil {
+		return err
+	}
+
 	gsiList := make([]map[string]interface{}, 0, len(table.GlobalSecondaryIndexes))
 	for _, gsiObject := range table.GlobalSecondaryIndexes {
 		gsi := map[string]interface{}{
@@ -703,54 +747,54 @@ func resourceDashsoftAwsDynamoDbTableRead(d *schema.ResourceData, meta interface
 
 	d.Set("arn", table.TableArn)
 
-	return nil
+	tags, err := dynamodbTagger(dynamodbconn, *table.TableArn).list()
+	if err != nil {
+		return awsError("dashsoftaws_dynamodb_table", d.Id(), "ListTagsOfResource", err)
+	}
+	return setTags(d, meta, tags)
 }
 
 func resourceDashsoftAwsDynamoDbTableDelete(d *schema.ResourceData, meta interface{}) error {
-	dynamodbconn := meta.(*AWSClient).dynamodbconn
+	dynamodbconn := meta.(*AWSClient).dynamodbconn()
 
-	waitForTableToBeActive(d.Id(), meta)
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	if err := waitForTableToBeActive(ctx, d.Id(), meta); err != nil {
+		return err
+	}
 
 	log.Printf("[DEBUG] DynamoDB delete table: %s", d.Id())
 
-	_, err := dynamodbconn.DeleteTable(&dynamodb.DeleteTableInput{
+	_, err := dynamodbconn.DeleteTableWithContext(ctx, &dynamodb.DeleteTableInput{
 		TableName: aws.String(d.Id()),
 	})
 	if err != nil {
-		return err
+		return awsError("dashsoftaws_dynamodb_table", d.Id(), "DeleteTable", err)
 	}
 
 	params := &dynamodb.DescribeTableInput{
 		TableName: aws.String(d.Id()),
 	}
 
-	err = resource.Retry(10*time.Minute, func() *resource.RetryError {
-		t, err := dynamodbconn.DescribeTable(params)
-		if err != nil {
-			if awserr, ok := err.(awserr.Error); ok && awserr.Code() == "ResourceNotFoundException" {
-				return nil
-			}
-			// Didn't recognize the error, so shouldn't retry.
-			return resource.NonRetryableError(err)
-		}
-
-		if t != nil {
-			if t.Table.TableStatus != nil && strings.ToLower(*t.Table.TableStatus) == "deleting" {
-				log.Printf("[DEBUG] AWS Dynamo DB table (%s) is still deleting", d.Id())
-				return resource.RetryableError(fmt.Errorf("still deleting"))
+	_, err = waitForState(fmt.Sprintf("DynamoDB table %s to be deleted", d.Id()), &resource.StateChangeConf{
+		Pending: []string{"DELETING"},
+		Target:  []string{},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			t, err := dynamodbconn.DescribeTableWithContext(ctx, params)
+			if err != nil {
+				if awserr, ok := err.(awserr.Error); ok && awserr.Code() == "ResourceNotFoundException" {
+					return nil, "", nil
+				}
+				return nil, "", awsError("dashsoftaws_dynamodb_table", d.Id(), "DescribeTable", err)
 			}
-		}
 
-		// we should be not found or deleting, so error here
-		return resource.NonRetryableError(err)
+			log.Printf("[DEBUG] AWS Dynamo DB table (%s) is still %s", d.Id(), *t.Table.TableStatus)
+			return t.Table, *t.Table.TableStatus, nil
+		},
 	})
-
-	// check error from retry
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return err
 }
 
 func createGSIFromData(data *map[string]interface{}) dynamodb.GlobalSecondaryIndex {
@@ -822,74 +866,58 @@ func getAttributeType(d *schema.ResourceData, attributeName string) (string, err
 	return "", fmt.Errorf("Unable to find an attribute named %s", attributeName)
 }
 
-func waitForGSIToBeActive(tableName string, gsiName string, meta interface{}) error {
-	dynamodbconn := meta.(*AWSClient).dynamodbconn
+func waitForGSIToBeActive(ctx aws.Context, tableName string, gsiName string, meta interface{}) error {
+	dynamodbconn := meta.(*AWSClient).dynamodbconn()
 	req := &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	}
 
-	activeIndex := false
-
-	for activeIndex == false {
-
-		result, err := dynamodbconn.DescribeTable(req)
-
-		if err != nil {
-			return err
-		}
-
-		table := result.Table
-		var targetGSI *dynamodb.GlobalSecondaryIndexDescription = nil
-
-		for _, gsi := range table.GlobalSecondaryIndexes {
-			if *gsi.IndexName == gsiName {
-				targetGSI = gsi
+	_, err := waitForState(fmt.Sprintf("GSI %s of DynamoDB table %s to become active", gsiName, tableName), &resource.StateChangeConf{
+		Pending: []string{"CREATING", "UPDATING"},
+		Target:  []string{"ACTIVE"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			result, err := dynamodbconn.DescribeTableWithContext(ctx, req)
+			if err != nil {
+				return nil, "", awsError("dashsoftaws_dynamodb_table", tableName, "DescribeTable", err)
 			}
-		}
-
-		if targetGSI != nil {
-			activeIndex = *targetGSI.IndexStatus == "ACTIVE"
 
-			if !activeIndex {
-				log.Printf("[DEBUG] Sleeping for 5 seconds for %s GSI to become active", gsiName)
-				time.Sleep(5 * time.Second)
+			for _, gsi := range result.Table.GlobalSecondaryIndexes {
+				if *gsi.IndexName == gsiName {
+					log.Printf("[DEBUG] GSI %s is %s", gsiName, *gsi.IndexStatus)
+					return gsi, *gsi.IndexStatus, nil
+				}
 			}
-		} else {
-			log.Printf("[DEBUG] GSI %s did not exist, giving up", gsiName)
-			break
-		}
-	}
-
-	return nil
 
+			// Nothing left to wait for
+			log.Printf("[DEBUG] GSI %s did not exist, giving up", gsiName)
+			return result.Table, "ACTIVE", nil
+		},
+	})
+	return err
 }
 
-func waitForTableToBeActive(tableName string, meta interface{}) error {
-	dynamodbconn := meta.(*AWSClient).dynamodbconn
+func waitForTableToBeActive(ctx aws.Context, tableName string, meta interface{}) error {
+	dynamodbconn := meta.(*AWSClient).dynamodbconn()
 	req := &dynamodb.DescribeTableInput{
 		TableName: aws.String(tableName),
 	}
 
-	activeState := false
-
-	for activeState == false {
-		result, err := dynamodbconn.DescribeTable(req)
-
-		if err != nil {
-			return err
-		}
-
-		activeState = *result.Table.TableStatus == "ACTIVE"
-
-		// Wait for a few seconds
-		if !activeState {
-			log.Printf("[DEBUG] Sleeping for 5 seconds for table to become active")
-			time.Sleep(5 * time.Second)
-		}
-	}
-
-	return nil
+	_, err := waitForState(fmt.Sprintf("DynamoDB table %s to become active", tableName), &resource.StateChangeConf{
+		Pending: []string{"CREATING", "UPDATING"},
+		Target:  []string{"ACTIVE"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			result, err := dynamodbconn.DescribeTableWithContext(ctx, req)
+			if err != nil {
+				return nil, "", awsError("dashsoftaws_dynamodb_table", tableName, "DescribeTable", err)
+			}
 
+			log.Printf("[DEBUG] DynamoDB table %s is %s", tableName, *result.Table.TableStatus)
+			return result.Table, *result.Table.TableStatus, nil
+		},
+	})
+	return err
 }
 
 func validateStreamViewType(v interface{}, k string) (ws []string, errors []error) {
@@ -0,0 +1,194 @@
+package dashsoftaws
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsDynamoDbTable_basic(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	var table dynamodb.TableDescription
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsDynamoDbTableDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsDynamoDbTableConfig, 5, 5, 1, "false", "blue"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsDynamoDbTableExists(provider, "dashsoftaws_dynamodb_table.test", &table),
+					testAccCheckDashsoftAwsDynamoDbTableThroughput(&table, 5, 5),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "name", "test"),
+					resource.TestCheckResourceAttrSet("dashsoftaws_dynamodb_table.test", "arn"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "hash_key", "id"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "range_key", "created"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "attribute.#", "3"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "global_secondary_index.#", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "stream_enabled", "false"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "tags.color", "blue"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsDynamoDbTableConfig, 10, 20, 2, "true", "green"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsDynamoDbTableExists(provider, "dashsoftaws_dynamodb_table.test", &table),
+					testAccCheckDashsoftAwsDynamoDbTableThroughput(&table, 10, 20),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "read_capacity", "10"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "write_capacity", "20"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "global_secondary_index.#", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "stream_enabled", "true"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "stream_view_type", "NEW_AND_OLD_IMAGES"),
+					resource.TestCheckResourceAttrSet("dashsoftaws_dynamodb_table.test", "stream_arn"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "tags.color", "green"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				Config:            testAccConfig(server, testAccDashsoftAwsDynamoDbTableConfig, 10, 20, 2, "true", "green"),
+				ResourceName:      "dashsoftaws_dynamodb_table.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+				// only_scale_up is a setting of the resource, not of the table
+				ImportStateVerifyIgnore: []string{"only_scale_up"},
+			}),
+		},
+	})
+}
+
+// All the tags of a table are read, beyond the first page of
+// ListTagsOfResource.
+func TestAccDashsoftAwsDynamoDbTable_manyTags(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	var tags bytes.Buffer
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&tags, "    tag%02d = \"value%02d\"\n", i, i)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsDynamoDbTableDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsDynamoDbTableConfigTags, tags.String()),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "tags.%", "25"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "tags.tag00", "value00"),
+					resource.TestCheckResourceAttr("dashsoftaws_dynamodb_table.test", "tags.tag24", "value24"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				Config:                  testAccConfig(server, testAccDashsoftAwsDynamoDbTableConfigTags, tags.String()),
+				ResourceName:            "dashsoftaws_dynamodb_table.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"only_scale_up"},
+			}),
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsDynamoDbTableExists(provider *schema.Provider, name string, table *dynamodb.TableDescription) resource.TestCheckFunc {
+	return testAccCheckResourceExists(name, func(id string) error {
+		out, err := testAccClient(provider).dynamodbconn().DescribeTable(&dynamodb.DescribeTableInput{
+			TableName: aws.String(id),
+		})
+		if err != nil {
+			return err
+		}
+		*table = *out.Table
+		return nil
+	})
+}
+
+func testAccCheckDashsoftAwsDynamoDbTableThroughput(table *dynamodb.TableDescription, read, write int64) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		throughput := table.ProvisionedThroughput
+		if aws.Int64Value(throughput.ReadCapacityUnits) != read || aws.Int64Value(throughput.WriteCapacityUnits) != write {
+			return fmt.Errorf("Expected table %s to have a throughput of %d/%d, got %d/%d", *table.TableName, read, write,
+				aws.Int64Value(throughput.ReadCapacityUnits), aws.Int64Value(throughput.WriteCapacityUnits))
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsDynamoDbTableDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_dynamodb_table", func(id string, _ map[string]string) error {
+		_, err := testAccClient(provider).dynamodbconn().DescribeTable(&dynamodb.DescribeTableInput{
+			TableName: aws.String(id),
+		})
+		if err == nil {
+			return fmt.Errorf("DynamoDB table %s still exists", id)
+		}
+		if testAccErrorCode(err) != "ResourceNotFoundException" {
+			return err
+		}
+		return nil
+	})
+}
+
+const testAccDashsoftAwsDynamoDbTableConfig = `
+resource "dashsoftaws_dynamodb_table" "test" {
+  name           = "test"
+  hash_key       = "id"
+  range_key      = "created"
+  read_capacity  = %d
+  write_capacity = %d
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  attribute {
+    name = "created"
+    type = "N"
+  }
+
+  attribute {
+    name = "owner"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "owner"
+    hash_key        = "owner"
+    read_capacity   = %[3]d
+    write_capacity  = %[3]d
+    projection_type = "KEYS_ONLY"
+  }
+
+  stream_enabled   = %[4]s
+  stream_view_type = "NEW_AND_OLD_IMAGES"
+
+  tags {
+    color = %[5]q
+  }
+}
+`
+
+const testAccDashsoftAwsDynamoDbTableConfigTags = `
+resource "dashsoftaws_dynamodb_table" "test" {
+  name           = "test"
+  hash_key       = "id"
+  read_capacity  = 5
+  write_capacity = 5
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  tags {
+%s  }
+}
+`
@@ -1,22 +1,58 @@
 package dashsoftaws
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
+// The attachments status of a cluster while capacity providers are being
+// attached, which the ECS API has no constants for.
+const (
+	ecsAttachmentsUpdateInProgress = "UPDATE_IN_PROGRESS"
+	ecsAttachmentsUpdateComplete   = "UPDATE_COMPLETE"
+	ecsAttachmentsUpdateFailed     = "UPDATE_FAILED"
+)
+
+// The values of service_deletion_policy: what deleting the cluster does to
+// the services still in it.
+const (
+	ecsServiceDeletionPolicyForce     = "force"
+	ecsServiceDeletionPolicyFail      = "fail"
+	ecsServiceDeletionPolicyScaleOnly = "scale_only"
+)
+
+// ecsDefaultTaskStopReason is the default of task_stop_reason.
+const ecsDefaultTaskStopReason = "Stopped by Terraform to delete the ECS cluster"
+
 func resourceDashsoftAwsEcsCluster() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceDashsoftAwsEcsClusterCreate,
 		Read:   resourceDashsoftAwsEcsClusterRead,
+		Update: resourceDashsoftAwsEcsClusterUpdate,
 		Delete: resourceDashsoftAwsEcsClusterDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceDashsoftAwsEcsClusterImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": &schema.Schema{
@@ -24,44 +60,153 @@ func resourceDashsoftAwsEcsCluster() *schema.Resource {
 				Required: true,
 				ForceNew: true,
 			},
+			"setting": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateEcsClusterSettingName,
+						},
+						"value": &schema.Schema{
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateEcsClusterSettingValue,
+						},
+					},
+				},
+				Set: func(v interface{}) int {
+					var buf bytes.Buffer
+					m := v.(map[string]interface{})
+					buf.WriteString(fmt.Sprintf("%s-", m["name"].(string)))
+					buf.WriteString(fmt.Sprintf("%s-", m["value"].(string)))
+					return hashcode.String(buf.String())
+				},
+			},
+			"capacity_providers": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"default_capacity_provider_strategy": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"capacity_provider": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"weight": &schema.Schema{
+							Type:     schema.TypeInt,
+							Optional: true,
+							Default:  0,
+						},
+						"base": &schema.Schema{
+							Type:     schema.TypeInt,
+							Optional: true,
+							Default:  0,
+						},
+					},
+				},
+				Set: func(v interface{}) int {
+					var buf bytes.Buffer
+					m := v.(map[string]interface{})
+					buf.WriteString(fmt.Sprintf("%s-", m["capacity_provider"].(string)))
+					buf.WriteString(fmt.Sprintf("%d-", m["weight"].(int)))
+					buf.WriteString(fmt.Sprintf("%d-", m["base"].(int)))
+					return hashcode.String(buf.String())
+				},
+			},
+			"deletion_protection": deletionProtectionSchema(),
+			"service_deletion_policy": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      ecsServiceDeletionPolicyForce,
+				ValidateFunc: validateEcsServiceDeletionPolicy,
+				Description:  "What deleting the cluster does to its services: force scales them down and deletes them, fail refuses to delete the cluster, scale_only scales them down and fails the delete, leaving deleting them to their owner.",
+			},
+			"service_name_filter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateEcsServiceNameFilter,
+				Description:  "Regular expression the names of the services service_deletion_policy applies to must match. All services by default. The delete fails before changing anything while other services are in the cluster.",
+			},
+			"task_stop_reason": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     ecsDefaultTaskStopReason,
+				Description: "The reason given to StopTask for the tasks still running when the cluster is deleted.",
+			},
+			"force_deregister_instances": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Drain and deregister the container instances of the cluster before deleting it.",
+			},
+			"tags":     tagsSchema(),
+			"tags_all": tagsAllSchema(),
 		},
 	}
 }
 
 func resourceDashsoftAwsEcsClusterCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).ecsconn
+	conn := meta.(*AWSClient).ecsconn()
 
 	clusterName := d.Get("name").(string)
 	log.Printf("[DEBUG] Creating ECS cluster %s", clusterName)
 
-	out, err := conn.CreateCluster(&ecs.CreateClusterInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	input := &ecs.CreateClusterInput{
 		ClusterName: aws.String(clusterName),
-	})
+		Tags:        ecsTags(wantedTags(d, meta)),
+	}
+	if v, ok := d.GetOk("setting"); ok {
+		input.Settings = expandEcsClusterSettings(v.(*schema.Set))
+	}
+	if v, ok := d.GetOk("capacity_providers"); ok {
+		input.CapacityProviders = expandStringSet(v.(*schema.Set))
+	}
+	if v, ok := d.GetOk("default_capacity_provider_strategy"); ok {
+		input.DefaultCapacityProviderStrategy = expandEcsCapacityProviderStrategy(v.(*schema.Set))
+	}
+
+	out, err := conn.CreateClusterWithContext(ctx, input)
 	if err != nil {
-		return err
+		return awsError("dashsoftaws_ecs_cluster", clusterName, "CreateCluster", err)
 	}
 	log.Printf("[DEBUG] ECS cluster %s created", *out.Cluster.ClusterArn)
 
 	d.SetId(*out.Cluster.ClusterArn)
 	d.Set("name", *out.Cluster.ClusterName)
-	return nil
+	return resourceDashsoftAwsEcsClusterRead(d, meta)
 }
 
 func resourceDashsoftAwsEcsClusterRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).ecsconn
+	conn := meta.(*AWSClient).ecsconn()
 
-	clusterName := d.Get("name").(string)
-	log.Printf("[DEBUG] Reading ECS cluster %s", clusterName)
+	// The ID is the ARN of the cluster, or its name when imported by name
+	log.Printf("[DEBUG] Reading ECS cluster %s", d.Id())
 	out, err := conn.DescribeClusters(&ecs.DescribeClustersInput{
-		Clusters: []*string{aws.String(clusterName)},
+		Clusters: []*string{aws.String(d.Id())},
+		Include: []*string{
+			aws.String(ecs.ClusterFieldSettings),
+			aws.String(ecs.ClusterFieldTags),
+		},
 	})
 	if err != nil {
-		return err
+		return awsError("dashsoftaws_ecs_cluster", d.Id(), "DescribeClusters", err)
 	}
 	log.Printf("[DEBUG] Received ECS clusters: %s", out.Clusters)
 
 	for _, c := range out.Clusters {
-		if *c.ClusterName == clusterName {
+		if *c.ClusterArn == d.Id() || *c.ClusterName == d.Id() {
 			// Status==INACTIVE means deleted cluster
 			if *c.Status == "INACTIVE" {
 				log.Printf("[DEBUG] Removing ECS cluster %q because it's INACTIVE", *c.ClusterArn)
@@ -71,7 +216,16 @@ func resourceDashsoftAwsEcsClusterRead(d *schema.ResourceData, meta interface{})
 
 			d.SetId(*c.ClusterArn)
 			d.Set("name", c.ClusterName)
-			return nil
+			if err := d.Set("setting", flattenEcsClusterSettings(c.Settings)); err != nil {
+				return err
+			}
+			if err := d.Set("capacity_providers", aws.StringValueSlice(c.CapacityProviders)); err != nil {
+				return err
+			}
+			if err := d.Set("default_capacity_provider_strategy", flattenEcsCapacityProviderStrategy(c.DefaultCapacityProviderStrategy)); err != nil {
+				return err
+			}
+			return setTags(d, meta, ecsTagsToMap(c.Tags))
 		}
 	}
 
@@ -80,102 +234,752 @@ func resourceDashsoftAwsEcsClusterRead(d *schema.ResourceData, meta interface{})
 	return nil
 }
 
+func resourceDashsoftAwsEcsClusterUpdate(d *schema.ResourceData, meta interface{}) error {
+	conn := meta.(*AWSClient).ecsconn()
+
+	clusterName := d.Get("name").(string)
+
+	ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+	defer cancel()
+
+	if d.HasChange("setting") {
+		settings := expandEcsClusterSettings(d.Get("setting").(*schema.Set))
+		log.Printf("[DEBUG] Updating settings of ECS cluster %s: %s", clusterName, settings)
+		_, err := conn.UpdateClusterSettingsWithContext(ctx, &ecs.UpdateClusterSettingsInput{
+			Cluster:  aws.String(d.Id()),
+			Settings: settings,
+		})
+		if err != nil {
+			return awsError("dashsoftaws_ecs_cluster", clusterName, "UpdateClusterSettings", err)
+		}
+	}
+
+	// PutClusterCapacityProviders replaces both the capacity providers and the
+	// default strategy, so both are always sent
+	if d.HasChange("capacity_providers") || d.HasChange("default_capacity_provider_strategy") {
+		input := &ecs.PutClusterCapacityProvidersInput{
+			Cluster:                         aws.String(d.Id()),
+			CapacityProviders:               expandStringSet(d.Get("capacity_providers").(*schema.Set)),
+			DefaultCapacityProviderStrategy: expandEcsCapacityProviderStrategy(d.Get("default_capacity_provider_strategy").(*schema.Set)),
+		}
+		log.Printf("[DEBUG] Updating capacity providers of ECS cluster %s: %s", clusterName, input)
+		if _, err := conn.PutClusterCapacityProvidersWithContext(ctx, input); err != nil {
+			return awsError("dashsoftaws_ecs_cluster", clusterName, "PutClusterCapacityProviders", err)
+		}
+
+		// The capacity providers are attached to the cluster asynchronously
+		_, err := waitForState(fmt.Sprintf("capacity providers of ECS cluster %s to be attached", clusterName), &resource.StateChangeConf{
+			Pending: []string{ecsAttachmentsUpdateInProgress},
+			Target:  []string{ecsAttachmentsUpdateComplete},
+			Timeout: remainingTimeout(ctx),
+			Refresh: func() (interface{}, string, error) {
+				out, err := conn.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+					Clusters: []*string{aws.String(d.Id())},
+					Include:  []*string{aws.String(ecs.ClusterFieldAttachments)},
+				})
+				if err != nil {
+					return nil, "", awsError("dashsoftaws_ecs_cluster", clusterName, "DescribeClusters", err)
+				}
+				if len(out.Clusters) == 0 {
+					return nil, "", fmt.Errorf("ECS cluster %s not found", clusterName)
+				}
+
+				status := aws.StringValue(out.Clusters[0].AttachmentsStatus)
+				if status == ecsAttachmentsUpdateFailed {
+					return nil, "", fmt.Errorf("Attaching capacity providers to ECS cluster %s failed", clusterName)
+				}
+				// A cluster without attachments has no status for them
+				if status == "" {
+					status = ecsAttachmentsUpdateComplete
+				}
+				return out.Clusters[0], status, nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("tags") {
+		if err := updateTags(d, meta, "dashsoftaws_ecs_cluster", ecsTagger(conn, d.Id())); err != nil {
+			return err
+		}
+	}
+
+	return resourceDashsoftAwsEcsClusterRead(d, meta)
+}
+
 func resourceDashsoftAwsEcsClusterDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).ecsconn
+	conn := meta.(*AWSClient).ecsconn()
 
 	clusterName := d.Get("name").(string)
+	if err := checkDeletionAllowed(d, meta, "ECS cluster", clusterName); err != nil {
+		return err
+	}
+
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
 
-	servicesOut, servicesErr := conn.ListServices(&ecs.ListServicesInput{
+	// All pages are listed before any service is deleted, as deleting
+	// services moves the others between pages
+	var serviceArns []*string
+	servicesErr := conn.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{
 		Cluster: aws.String(clusterName),
+	}, func(page *ecs.ListServicesOutput, lastPage bool) bool {
+		serviceArns = append(serviceArns, page.ServiceArns...)
+		return true
 	})
 	if servicesErr != nil {
-		return servicesErr
+		return awsError("dashsoftaws_ecs_cluster", clusterName, "ListServices", servicesErr)
 	}
 
-	for _, serviceArn := range servicesOut.ServiceArns {
-		updateInput := ecs.UpdateServiceInput{
-			Service:      aws.String(*serviceArn),
-			Cluster:      aws.String(clusterName),
-			DesiredCount: aws.Int64(int64(0)),
+	filter := d.Get("service_name_filter").(string)
+	services, excluded, err := filterEcsServices(serviceArns, filter)
+	if err != nil {
+		return err
+	}
+	// The services left alone keep DeleteCluster failing, so nothing is
+	// changed when the cluster can't be deleted anyway
+	if len(excluded) > 0 {
+		return fmt.Errorf("Refusing to delete ECS cluster %s: its services %s don't match service_name_filter %q and would keep it from being deleted. "+
+			"Delete them before destroying the cluster, or change service_name_filter",
+			clusterName, strings.Join(ecsServiceNames(excluded), ", "), filter)
+	}
+
+	switch policy := d.Get("service_deletion_policy").(string); policy {
+	case ecsServiceDeletionPolicyFail:
+		if len(services) > 0 {
+			return fmt.Errorf("Refusing to delete ECS cluster %s: it still has the services %s and service_deletion_policy is fail. "+
+				"Delete the services before destroying the cluster, or set service_deletion_policy to force",
+				clusterName, strings.Join(ecsServiceNames(services), ", "))
 		}
-		_, updateErr := conn.UpdateService(&updateInput)
-		if updateErr != nil {
-			return updateErr
+	default:
+		scaleOnly := policy == ecsServiceDeletionPolicyScaleOnly
+		done, err := deleteEcsServices(ctx, conn, clusterName, services, scaleOnly)
+		if len(services) > 0 {
+			record := auditRecord{
+				Service:   "ecs",
+				Operation: "DeleteClusterServices",
+				Parameters: map[string]interface{}{
+					"cluster":                 clusterName,
+					"service_deletion_policy": policy,
+					"services":                done,
+				},
+				Outcome: "success",
+			}
+			if scaleOnly {
+				record.Operation = "ScaleDownClusterServices"
+			}
+			if err != nil {
+				record.Outcome = "error"
+				record.Error = err.Error()
+			}
+			meta.(*AWSClient).audit(record)
 		}
-		log.Printf("[DEBUG] Set DesiredCount to 0 for service %s", *serviceArn)
-
-		deleteInput := ecs.DeleteServiceInput{
-			Service: aws.String(*serviceArn),
-			Cluster: aws.String(clusterName),
+		if err != nil {
+			return err
 		}
+		// The services scaled down keep DeleteCluster failing until their
+		// owner deletes them
+		if scaleOnly && len(services) > 0 {
+			return fmt.Errorf("Not deleting ECS cluster %s: service_deletion_policy is scale_only and the services %s, now scaled down, are left to their owner. "+
+				"Delete them before destroying the cluster again, or set service_deletion_policy to force",
+				clusterName, strings.Join(ecsServiceNames(services), ", "))
+		}
+	}
 
-		_, deleteErr := conn.DeleteService(&deleteInput)
-		if deleteErr != nil {
-			return deleteErr
+	// Tasks started outside of a service, e.g. with RunTask, keep the cluster
+	// from going INACTIVE and container instances from draining. The tasks of
+	// services are stopped by scaling the services down
+	if err := stopEcsTasks(ctx, conn, clusterName, d.Get("task_stop_reason").(string)); err != nil {
+		return err
+	}
+
+	if d.Get("force_deregister_instances").(bool) {
+		if err := deregisterEcsContainerInstances(ctx, conn, clusterName); err != nil {
+			return err
 		}
-		log.Printf("[DEBUG] Delete found service %s", *serviceArn)
 	}
 
 	log.Printf("[DEBUG] Deleting ECS cluster %s", d.Id())
 
-	err := resource.Retry(10*time.Minute, func() *resource.RetryError {
-		out, err := conn.DeleteCluster(&ecs.DeleteClusterInput{
-			Cluster: aws.String(d.Id()),
-		})
+	// Container instances, services and tasks that are still going away make
+	// DeleteCluster fail for a while. The retryer of the session retries it
+	// max_retries times, and once those are used up it is called again until
+	// the delete timeout is over, as slow drains take much longer.
+	_, err = waitForState(fmt.Sprintf("ECS cluster %s to be emptied", clusterName), &resource.StateChangeConf{
+		Pending: []string{"NOT_EMPTY"},
+		Target:  []string{"DELETED"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			out, err := conn.DeleteClusterWithContext(ctx, &ecs.DeleteClusterInput{
+				Cluster: aws.String(d.Id()),
+			})
+			if awsErr, ok := err.(awserr.Error); ok && isEcsClusterNotEmptyError(awsErr.Code()) {
+				log.Printf("[DEBUG] ECS cluster %s is not empty yet: %s", d.Id(), awsErr.Code())
+				return awsErr, "NOT_EMPTY", nil
+			}
+			if err != nil {
+				return nil, "", awsError("dashsoftaws_ecs_cluster", clusterName, "DeleteCluster", err)
+			}
 
-		if err == nil {
 			log.Printf("[DEBUG] ECS cluster %s deleted: %s", d.Id(), out)
-			return nil
-		}
+			return out, "DELETED", nil
+		},
+	})
+	if err != nil {
+		return err
+	}
 
-		awsErr, ok := err.(awserr.Error)
-		if !ok {
-			return resource.NonRetryableError(err)
+	_, err = waitForState(fmt.Sprintf("ECS cluster %s to become INACTIVE", clusterName), &resource.StateChangeConf{
+		Pending: []string{"ACTIVE", "DEPROVISIONING"},
+		Target:  []string{"INACTIVE"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			log.Printf("[DEBUG] Checking if ECS Cluster %q is INACTIVE", d.Id())
+			out, err := conn.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
+				Clusters: []*string{aws.String(clusterName)},
+			})
+			if err != nil {
+				return nil, "", awsError("dashsoftaws_ecs_cluster", clusterName, "DescribeClusters", err)
+			}
+
+			for _, c := range out.Clusters {
+				if *c.ClusterName == clusterName {
+					return c, *c.Status, nil
+				}
+			}
+
+			// A cluster that is not described anymore is as gone as an
+			// INACTIVE one
+			return out, "INACTIVE", nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] ECS cluster %q deleted", d.Id())
+	return nil
+}
+
+// expandEcsClusterSettings returns the settings of the setting attribute.
+// resourceDashsoftAwsEcsClusterImport imports a cluster by its name. The
+// attributes that only tell the provider how to delete the cluster are not
+// stored in AWS, so they get their defaults, as if they were not configured.
+func resourceDashsoftAwsEcsClusterImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	d.Set("deletion_protection", false)
+	d.Set("service_deletion_policy", ecsServiceDeletionPolicyForce)
+	d.Set("task_stop_reason", ecsDefaultTaskStopReason)
+	d.Set("force_deregister_instances", false)
+	return []*schema.ResourceData{d}, nil
+}
+
+func expandEcsClusterSettings(s *schema.Set) []*ecs.ClusterSetting {
+	var settings []*ecs.ClusterSetting
+	for _, v := range s.List() {
+		m := v.(map[string]interface{})
+		settings = append(settings, &ecs.ClusterSetting{
+			Name:  aws.String(m["name"].(string)),
+			Value: aws.String(m["value"].(string)),
+		})
+	}
+	return settings
+}
+
+func flattenEcsClusterSettings(settings []*ecs.ClusterSetting) []interface{} {
+	var result []interface{}
+	for _, setting := range settings {
+		result = append(result, map[string]interface{}{
+			"name":  aws.StringValue(setting.Name),
+			"value": aws.StringValue(setting.Value),
+		})
+	}
+	return result
+}
+
+// expandEcsCapacityProviderStrategy returns the strategy of the
+// default_capacity_provider_strategy attribute. An empty strategy is an
+// empty list rather than nil, which PutClusterCapacityProviders requires.
+func expandEcsCapacityProviderStrategy(s *schema.Set) []*ecs.CapacityProviderStrategyItem {
+	strategy := []*ecs.CapacityProviderStrategyItem{}
+	for _, v := range s.List() {
+		m := v.(map[string]interface{})
+		strategy = append(strategy, &ecs.CapacityProviderStrategyItem{
+			CapacityProvider: aws.String(m["capacity_provider"].(string)),
+			Weight:           aws.Int64(int64(m["weight"].(int))),
+			Base:             aws.Int64(int64(m["base"].(int))),
+		})
+	}
+	return strategy
+}
+
+func flattenEcsCapacityProviderStrategy(strategy []*ecs.CapacityProviderStrategyItem) []interface{} {
+	var result []interface{}
+	for _, item := range strategy {
+		result = append(result, map[string]interface{}{
+			"capacity_provider": aws.StringValue(item.CapacityProvider),
+			"weight":            int(aws.Int64Value(item.Weight)),
+			"base":              int(aws.Int64Value(item.Base)),
+		})
+	}
+	return result
+}
+
+// expandStringSet returns the strings of a set of strings, as an empty list
+// rather than nil for an empty set.
+func expandStringSet(s *schema.Set) []*string {
+	result := []*string{}
+	for _, v := range s.List() {
+		result = append(result, aws.String(v.(string)))
+	}
+	return result
+}
+
+func validateEcsClusterSettingName(v interface{}, k string) (ws []string, errors []error) {
+	if v.(string) != ecs.ClusterSettingNameContainerInsights {
+		errors = append(errors, fmt.Errorf("%q must be %s", k, ecs.ClusterSettingNameContainerInsights))
+	}
+	return
+}
+
+func validateEcsClusterSettingValue(v interface{}, k string) (ws []string, errors []error) {
+	switch v.(string) {
+	case "enabled", "disabled":
+	default:
+		errors = append(errors, fmt.Errorf("%q must be enabled or disabled", k))
+	}
+	return
+}
+
+// filterEcsServices splits the ARNs of the services between the ones whose
+// name matches the service_name_filter regular expression, all of them without
+// a filter, and the ones it excludes.
+func filterEcsServices(serviceArns []*string, filter string) (matching, excluded []string, err error) {
+	if filter == "" {
+		return aws.StringValueSlice(serviceArns), nil, nil
+	}
+
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error compiling service_name_filter %q: %s", filter, err)
+	}
+
+	for _, serviceArn := range aws.StringValueSlice(serviceArns) {
+		name := ecsServiceName(serviceArn)
+		if re.MatchString(name) {
+			matching = append(matching, serviceArn)
+		} else {
+			log.Printf("[DEBUG] Service %s doesn't match service_name_filter", serviceArn)
+			excluded = append(excluded, serviceArn)
 		}
+	}
+	return matching, excluded, nil
+}
 
-		if awsErr.Code() == "ClusterContainsContainerInstancesException" {
-			log.Printf("[TRACE] Retrying ECS cluster %q deletion after %q", d.Id(), awsErr.Code())
-			return resource.RetryableError(err)
+// isEcsClusterNotEmptyError tells whether the error code of DeleteCluster is
+// one of those it fails with while the cluster still holds something.
+func isEcsClusterNotEmptyError(code string) bool {
+	for _, notEmpty := range retryableErrorCodes["ecs"]["DeleteCluster"] {
+		if code == notEmpty {
+			return true
 		}
+	}
+	return false
+}
+
+// ecsServiceName returns the name of the service with the given ARN, which
+// is the last part of both arn:...:service/name and the newer
+// arn:...:service/cluster/name.
+func ecsServiceName(serviceArn string) string {
+	return serviceArn[strings.LastIndex(serviceArn, "/")+1:]
+}
+
+// ecsServiceNames returns the sorted names of the services with the given
+// ARNs.
+func ecsServiceNames(serviceArns []string) []string {
+	names := make([]string, 0, len(serviceArns))
+	for _, serviceArn := range serviceArns {
+		names = append(names, ecsServiceName(serviceArn))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateEcsServiceDeletionPolicy(v interface{}, k string) (ws []string, errors []error) {
+	switch v.(string) {
+	case ecsServiceDeletionPolicyForce, ecsServiceDeletionPolicyFail, ecsServiceDeletionPolicyScaleOnly:
+	default:
+		errors = append(errors, fmt.Errorf("%q must be one of %s, %s, %s", k,
+			ecsServiceDeletionPolicyForce, ecsServiceDeletionPolicyFail, ecsServiceDeletionPolicyScaleOnly))
+	}
+	return
+}
+
+func validateEcsServiceNameFilter(v interface{}, k string) (ws []string, errors []error) {
+	if _, err := regexp.Compile(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q is not a valid regular expression: %s", k, err))
+	}
+	return
+}
+
+// ecsServiceDeleteConcurrency is the number of services of a cluster being
+// scaled down and deleted at the same time.
+const ecsServiceDeleteConcurrency = 10
+
+// deleteEcsServices scales the services down to 0, and deletes each of them
+// once it has no running tasks left, waiting for it to be INACTIVE within the
+// deadline of ctx. With scaleOnly, the services are left in place once they
+// have no running tasks. Services are handled concurrently; the error of a
+// service doesn't stop the others, and the services that failed are listed
+// together. It returns the names of the services deleted, or scaled down.
+func deleteEcsServices(ctx aws.Context, conn *ecs.ECS, clusterName string, serviceArns []string, scaleOnly bool) ([]string, error) {
+	if len(serviceArns) == 0 {
+		return nil, nil
+	}
+
+	action := "deleted"
+	if scaleOnly {
+		action = "scaled down"
+	}
+	log.Printf("[INFO] %d services of ECS cluster %s to be %s", len(serviceArns), clusterName, action)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		done  []string
+		stuck []string
+		errs  []error
+	)
+	sem := make(chan struct{}, ecsServiceDeleteConcurrency)
+	for _, serviceArn := range serviceArns {
+		wg.Add(1)
+		go func(serviceArn string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := deleteEcsService(ctx, conn, clusterName, serviceArn, scaleOnly)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				stuck = append(stuck, ecsServiceName(serviceArn))
+				errs = append(errs, err)
+			} else {
+				done = append(done, ecsServiceName(serviceArn))
+			}
+		}(serviceArn)
+	}
+	wg.Wait()
 
-		if awsErr.Code() == "ClusterContainsServicesException" {
-			log.Printf("[TRACE] Retrying ECS cluster %q deletion after %q", d.Id(), awsErr.Code())
-			return resource.RetryableError(err)
+	sort.Strings(done)
+	if len(errs) > 0 {
+		sort.Strings(stuck)
+		return done, fmt.Errorf("%d of %d services of ECS cluster %s could not be %s (%s): %s",
+			len(stuck), len(serviceArns), clusterName, action, strings.Join(stuck, ", "), &multierror.Error{Errors: errs})
+	}
+
+	log.Printf("[INFO] Services of ECS cluster %s %s: %s", clusterName, action, strings.Join(done, ", "))
+	return done, nil
+}
+
+// deleteEcsService scales the service down to 0, waits for its running count
+// to reach 0, and unless scaleOnly is set, deletes it and waits for it to be
+// INACTIVE.
+func deleteEcsService(ctx aws.Context, conn *ecs.ECS, clusterName, serviceArn string, scaleOnly bool) error {
+	_, err := conn.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
+		Service:      aws.String(serviceArn),
+		Cluster:      aws.String(clusterName),
+		DesiredCount: aws.Int64(int64(0)),
+	})
+	if err != nil {
+		return awsError("dashsoftaws_ecs_cluster", clusterName, "UpdateService", err)
+	}
+	log.Printf("[DEBUG] Set DesiredCount to 0 for service %s", serviceArn)
+
+	describeService := func() (*ecs.Service, error) {
+		out, err := conn.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(clusterName),
+			Services: []*string{aws.String(serviceArn)},
+		})
+		if err != nil {
+			return nil, awsError("dashsoftaws_ecs_cluster", clusterName, "DescribeServices", err)
+		}
+		for _, service := range out.Services {
+			if aws.StringValue(service.ServiceArn) == serviceArn {
+				return service, nil
+			}
 		}
+		return nil, nil
+	}
+
+	_, err = waitForState(fmt.Sprintf("ECS service %s to have no running tasks", serviceArn), &resource.StateChangeConf{
+		Pending: []string{"SCALING_DOWN"},
+		Target:  []string{"SCALED_DOWN"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			service, err := describeService()
+			if err != nil {
+				return nil, "", err
+			}
+			if service == nil {
+				return serviceArn, "SCALED_DOWN", nil
+			}
+
+			log.Printf("[DEBUG] ECS service %s has %d running tasks", serviceArn, aws.Int64Value(service.RunningCount))
+			if aws.Int64Value(service.RunningCount) > 0 {
+				return service, "SCALING_DOWN", nil
+			}
+			return service, "SCALED_DOWN", nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if scaleOnly {
+		log.Printf("[DEBUG] Leaving scaled down service %s in place", serviceArn)
+		return nil
+	}
+
+	_, err = conn.DeleteServiceWithContext(ctx, &ecs.DeleteServiceInput{
+		Service: aws.String(serviceArn),
+		Cluster: aws.String(clusterName),
+	})
+	if err != nil {
+		return awsError("dashsoftaws_ecs_cluster", clusterName, "DeleteService", err)
+	}
+	log.Printf("[DEBUG] Delete found service %s", serviceArn)
+
+	_, err = waitForState(fmt.Sprintf("ECS service %s to become INACTIVE", serviceArn), &resource.StateChangeConf{
+		Pending: []string{"ACTIVE", "DRAINING"},
+		Target:  []string{"INACTIVE"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			service, err := describeService()
+			if err != nil {
+				return nil, "", err
+			}
+			// A service that is not described anymore is as gone as an
+			// INACTIVE one
+			if service == nil {
+				return serviceArn, "INACTIVE", nil
+			}
+			return service, aws.StringValue(service.Status), nil
+		},
+	})
+	return err
+}
 
-		return resource.NonRetryableError(err)
+// ecsServiceTaskStartedByPrefix starts the startedBy of the tasks ECS starts
+// for a service, which goes on with the ID of the deployment.
+const ecsServiceTaskStartedByPrefix = "ecs-svc/"
+
+// stopEcsTasks stops the tasks of the cluster that are PENDING or RUNNING,
+// and waits for them to be STOPPED within the deadline of ctx. The tasks of
+// services are left alone: they go away with their service, and must keep
+// running when their service stays.
+func stopEcsTasks(ctx aws.Context, conn *ecs.ECS, clusterName, reason string) error {
+	// ECS never sets the desired status of a task to PENDING, so the tasks
+	// that are PENDING are listed along with the RUNNING ones
+	var listedArns []*string
+	err := conn.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(clusterName),
+		DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+	}, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		listedArns = append(listedArns, page.TaskArns...)
+		return true
 	})
+	if err != nil {
+		return awsError("dashsoftaws_ecs_cluster", clusterName, "ListTasks", err)
+	}
+
+	tasks, err := describeEcsTasks(ctx, conn, clusterName, listedArns)
 	if err != nil {
 		return err
 	}
+	var taskArns []*string
+	for _, task := range tasks {
+		if strings.HasPrefix(aws.StringValue(task.StartedBy), ecsServiceTaskStartedByPrefix) {
+			log.Printf("[DEBUG] Leaving task %s of service %s alone", aws.StringValue(task.TaskArn), aws.StringValue(task.Group))
+			continue
+		}
+		taskArns = append(taskArns, task.TaskArn)
+	}
+	if len(taskArns) == 0 {
+		log.Printf("[DEBUG] No tasks outside of services running in ECS cluster %s", clusterName)
+		return nil
+	}
 
-	err = resource.Retry(5*time.Minute, func() *resource.RetryError {
-		log.Printf("[DEBUG] Checking if ECS Cluster %q is INACTIVE", d.Id())
-		out, err := conn.DescribeClusters(&ecs.DescribeClustersInput{
-			Clusters: []*string{aws.String(clusterName)},
+	log.Printf("[INFO] Stopping %d tasks of ECS cluster %s", len(taskArns), clusterName)
+	for _, taskArn := range taskArns {
+		_, err := conn.StopTaskWithContext(ctx, &ecs.StopTaskInput{
+			Cluster: aws.String(clusterName),
+			Task:    taskArn,
+			Reason:  aws.String(reason),
 		})
+		if err != nil {
+			return awsError("dashsoftaws_ecs_cluster", clusterName, "StopTask", err)
+		}
+		log.Printf("[DEBUG] Requested stop of task %s", *taskArn)
+	}
 
-		for _, c := range out.Clusters {
-			if *c.ClusterName == clusterName {
-				if *c.Status == "INACTIVE" {
-					return nil
+	_, err = waitForState(fmt.Sprintf("tasks of ECS cluster %s to stop", clusterName), &resource.StateChangeConf{
+		Pending: []string{"STOPPING"},
+		Target:  []string{"STOPPED"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			tasks, err := describeEcsTasks(ctx, conn, clusterName, taskArns)
+			if err != nil {
+				return nil, "", err
+			}
+			// Stopped tasks are only described for a while, so a task
+			// missing from the output is stopped as well
+			var stopping int
+			for _, task := range tasks {
+				if aws.StringValue(task.LastStatus) != ecs.DesiredStatusStopped {
+					stopping++
 				}
+			}
 
-				return resource.RetryableError(
-					fmt.Errorf("ECS Cluster %q is still %q", clusterName, *c.Status))
+			log.Printf("[DEBUG] %d tasks of ECS cluster %s not STOPPED yet", stopping, clusterName)
+			if stopping > 0 {
+				return taskArns, "STOPPING", nil
 			}
+			return taskArns, "STOPPED", nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Stopped %d tasks of ECS cluster %s", len(taskArns), clusterName)
+	return nil
+}
+
+// describeEcsTasks describes the given tasks of the cluster, leaving out the
+// ones ECS does not describe anymore.
+func describeEcsTasks(ctx aws.Context, conn *ecs.ECS, clusterName string, taskArns []*string) ([]*ecs.Task, error) {
+	var tasks []*ecs.Task
+	// DescribeTasks takes 100 tasks at a time
+	for start := 0; start < len(taskArns); start += 100 {
+		end := start + 100
+		if end > len(taskArns) {
+			end = len(taskArns)
 		}
 
+		out, err := conn.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(clusterName),
+			Tasks:   taskArns[start:end],
+		})
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return nil, awsError("dashsoftaws_ecs_cluster", clusterName, "DescribeTasks", err)
 		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	return tasks, nil
+}
 
+// deregisterEcsContainerInstances sets the container instances of the cluster
+// to DRAINING, waits for their tasks to be stopped or moved, and deregisters
+// them, all within the deadline of ctx. Instances whose agent is disconnected
+// can't drain, so they are not waited for; they and any instance that still
+// has tasks once drained are deregistered with force, which leaves their EC2
+// instances running outside the cluster.
+func deregisterEcsContainerInstances(ctx aws.Context, conn *ecs.ECS, clusterName string) error {
+	var instanceArns []*string
+	err := conn.ListContainerInstancesPagesWithContext(ctx, &ecs.ListContainerInstancesInput{
+		Cluster: aws.String(clusterName),
+	}, func(page *ecs.ListContainerInstancesOutput, lastPage bool) bool {
+		instanceArns = append(instanceArns, page.ContainerInstanceArns...)
+		return true
+	})
+	if err != nil {
+		return awsError("dashsoftaws_ecs_cluster", clusterName, "ListContainerInstances", err)
+	}
+	if len(instanceArns) == 0 {
+		log.Printf("[DEBUG] No container instances registered to ECS cluster %s", clusterName)
 		return nil
+	}
+
+	// UpdateContainerInstancesState takes 10 instances at a time
+	log.Printf("[INFO] Draining %d container instances of ECS cluster %s", len(instanceArns), clusterName)
+	for start := 0; start < len(instanceArns); start += 10 {
+		end := start + 10
+		if end > len(instanceArns) {
+			end = len(instanceArns)
+		}
+
+		out, err := conn.UpdateContainerInstancesStateWithContext(ctx, &ecs.UpdateContainerInstancesStateInput{
+			Cluster:            aws.String(clusterName),
+			ContainerInstances: instanceArns[start:end],
+			Status:             aws.String(ecs.ContainerInstanceStatusDraining),
+		})
+		if err != nil {
+			return awsError("dashsoftaws_ecs_cluster", clusterName, "UpdateContainerInstancesState", err)
+		}
+		for _, f := range out.Failures {
+			log.Printf("[WARN] Could not drain container instance %s: %s", aws.StringValue(f.Arn), aws.StringValue(f.Reason))
+		}
+	}
+
+	_, err = waitForState(fmt.Sprintf("container instances of ECS cluster %s to drain", clusterName), &resource.StateChangeConf{
+		Pending: []string{"DRAINING"},
+		Target:  []string{"DRAINED"},
+		Timeout: remainingTimeout(ctx),
+		Refresh: func() (interface{}, string, error) {
+			var tasks int64
+			// DescribeContainerInstances takes 100 instances at a time
+			for start := 0; start < len(instanceArns); start += 100 {
+				end := start + 100
+				if end > len(instanceArns) {
+					end = len(instanceArns)
+				}
+
+				out, err := conn.DescribeContainerInstancesWithContext(ctx, &ecs.DescribeContainerInstancesInput{
+					Cluster:            aws.String(clusterName),
+					ContainerInstances: instanceArns[start:end],
+				})
+				if err != nil {
+					return nil, "", awsError("dashsoftaws_ecs_cluster", clusterName, "DescribeContainerInstances", err)
+				}
+				for _, ci := range out.ContainerInstances {
+					if aws.BoolValue(ci.AgentConnected) {
+						tasks += aws.Int64Value(ci.RunningTasksCount) + aws.Int64Value(ci.PendingTasksCount)
+					}
+				}
+			}
+
+			log.Printf("[DEBUG] %d tasks left on the container instances of ECS cluster %s", tasks, clusterName)
+			if tasks > 0 {
+				return instanceArns, "DRAINING", nil
+			}
+			return instanceArns, "DRAINED", nil
+		},
 	})
 	if err != nil {
 		return err
 	}
 
-	log.Printf("[DEBUG] ECS cluster %q deleted", d.Id())
+	for _, instanceArn := range instanceArns {
+		log.Printf("[DEBUG] Deregistering container instance %s", *instanceArn)
+		_, err := conn.DeregisterContainerInstanceWithContext(ctx, &ecs.DeregisterContainerInstanceInput{
+			Cluster:           aws.String(clusterName),
+			ContainerInstance: instanceArn,
+		})
+		if err != nil {
+			log.Printf("[WARN] Deregistering container instance %s failed, retrying with force: %s", *instanceArn, err)
+			_, err = conn.DeregisterContainerInstanceWithContext(ctx, &ecs.DeregisterContainerInstanceInput{
+				Cluster:           aws.String(clusterName),
+				ContainerInstance: instanceArn,
+				Force:             aws.Bool(true),
+			})
+		}
+		if err != nil {
+			return awsError("dashsoftaws_ecs_cluster", clusterName, "DeregisterContainerInstance", err)
+		}
+	}
+	log.Printf("[INFO] Deregistered %d container instances of ECS cluster %s", len(instanceArns), clusterName)
+
 	return nil
 }
@@ -0,0 +1,588 @@
+package dashsoftaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsEcsCluster_basic(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	var cluster ecs.Cluster
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfig, "disabled", "FARGATE", "blue"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsEcsClusterExists(provider, "dashsoftaws_ecs_cluster.test", &cluster),
+					testAccCheckDashsoftAwsEcsClusterSetting(&cluster, "containerInsights", "disabled"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "name", "test"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "setting.#", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "capacity_providers.#", "2"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "default_capacity_provider_strategy.#", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "tags.color", "blue"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfig, "enabled", "FARGATE_SPOT", "green"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsEcsClusterExists(provider, "dashsoftaws_ecs_cluster.test", &cluster),
+					testAccCheckDashsoftAwsEcsClusterSetting(&cluster, "containerInsights", "enabled"),
+					testAccCheckDashsoftAwsEcsClusterStrategy(&cluster, "FARGATE_SPOT"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "default_capacity_provider_strategy.#", "1"),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "tags.color", "green"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				Config:            testAccConfig(server, testAccDashsoftAwsEcsClusterConfig, "enabled", "FARGATE_SPOT", "green"),
+				ResourceName:      "dashsoftaws_ecs_cluster.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+			}),
+		},
+	})
+}
+
+// The services, tasks and container instances left in the cluster are
+// deleted, stopped and deregistered along with it.
+func TestAccDashsoftAwsEcsCluster_services(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigForceDeregister),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsEcsClusterExists(provider, "dashsoftaws_ecs_cluster.test", &ecs.Cluster{}),
+					resource.TestCheckResourceAttr("dashsoftaws_ecs_cluster.test", "force_deregister_instances", "true"),
+				),
+			},
+			{
+				PreConfig: func() {
+					instanceArn, err := server.AddECSContainerInstance("test", 2)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, name := range []string{"web", "worker"} {
+						if err := server.AddECSService("test", name, 1); err != nil {
+							t.Fatal(err)
+						}
+					}
+					if _, err := server.AddECSTask("test", instanceArn); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := server.AddECSTask("test", ""); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigForceDeregister),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 1, 2, 4),
+				),
+			},
+		},
+	})
+}
+
+// More services, tasks and container instances than fit in one page of
+// ListServices, ListTasks and ListContainerInstances, or in one call of
+// DescribeTasks and DescribeContainerInstances, are all processed.
+func TestAccDashsoftAwsEcsCluster_pagination(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: providers,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+			testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 0, 0, 0),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigForceDeregister),
+			},
+			{
+				PreConfig: func() {
+					for i := 0; i < 105; i++ {
+						if _, err := server.AddECSContainerInstance("test", 1); err != nil {
+							t.Fatal(err)
+						}
+						if err := server.AddECSService("test", fmt.Sprintf("service-%03d", i), 1); err != nil {
+							t.Fatal(err)
+						}
+					}
+					for i := 0; i < 120; i++ {
+						if _, err := server.AddECSTask("test", ""); err != nil {
+							t.Fatal(err)
+						}
+					}
+				},
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigForceDeregister),
+				Check:  testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 105, 105, 225),
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsEcsCluster_deletionProtection(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigDeletionProtection, true),
+			},
+			{
+				PreConfig: func() {
+					if err := server.AddECSService("test", "web", 1); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:      testAccConfig(server, testAccDashsoftAwsEcsClusterConfigDeletionProtection, true),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("Refusing to delete ECS cluster test: deletion_protection is set"),
+			},
+			{
+				// The refused delete left the service in place
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigDeletionProtection, false),
+				Check:  testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 0, 1, 1),
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsEcsCluster_deleteRetries(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				// The destroy goes on calling DeleteCluster within the timeout
+				// after it failed for longer than the max_retries retries of
+				// the session
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigDeleteTimeout, "10m"),
+				Check: func(*terraform.State) error {
+					return server.DelayECSClusterDeletion("test", 60)
+				},
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsEcsCluster_deleteTimeout(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	var cluster ecs.Cluster
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigDeleteTimeout, "2s"),
+				Check: func(s *terraform.State) error {
+					rs, ok := s.RootModule().Resources["dashsoftaws_ecs_cluster.test"]
+					if !ok {
+						return fmt.Errorf("Not found: dashsoftaws_ecs_cluster.test")
+					}
+
+					// Terraform 0.9 leaves the timeouts out of the diff of a
+					// destroy, so the cluster is deleted here with the ones of
+					// its state, like later versions do
+					if err := server.DelayECSClusterDeletion("test", 1000000); err != nil {
+						return err
+					}
+					diff := &terraform.InstanceDiff{Destroy: true, Meta: rs.Primary.Meta}
+					_, err := resourceDashsoftAwsEcsCluster().Apply(rs.Primary, diff, provider.Meta())
+					if err == nil || !regexp.MustCompile("Timed out after .* waiting for ECS cluster test to be emptied").MatchString(err.Error()) {
+						return fmt.Errorf("Expected the delete of the busy cluster to time out, got %v", err)
+					}
+					return server.DelayECSClusterDeletion("test", 0)
+				},
+			},
+			{
+				// The cluster that stayed busy past the timeout is kept
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigDeleteTimeout, "2s"),
+				Check:  testAccCheckDashsoftAwsEcsClusterExists(provider, "dashsoftaws_ecs_cluster.test", &cluster),
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsEcsCluster_serviceDeletionPolicy(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "dashsoftaws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	auditLogPath := filepath.Join(dir, "audit.log")
+	auditLogArgs := fmt.Sprintf("  audit_log_path = %q", auditLogPath)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: providers,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+			testAccCheckDashsoftAwsEcsClusterServicesAudit(auditLogPath, "DeleteClusterServices", "web"),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfigProvider(server, auditLogArgs, testAccDashsoftAwsEcsClusterConfigServices, "fail", ""),
+			},
+			{
+				PreConfig: func() {
+					if err := server.AddECSService("test", "web", 1); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:      testAccConfigProvider(server, auditLogArgs, testAccDashsoftAwsEcsClusterConfigServices, "fail", ""),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("it still has the services web and service_deletion_policy is fail"),
+			},
+			{
+				// The refused delete changed nothing
+				Config: testAccConfigProvider(server, auditLogArgs, testAccDashsoftAwsEcsClusterConfigServices, "fail", ""),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 0, 1, 1),
+					testAccCheckDashsoftAwsEcsClusterServiceTasks(provider, "test", "web", 1),
+					testAccCheckDashsoftAwsEcsClusterAuditOperations(auditLogPath, "CreateCluster"),
+				),
+			},
+			{
+				Config: testAccConfigProvider(server, auditLogArgs, testAccDashsoftAwsEcsClusterConfigServices, "force", ""),
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsEcsCluster_serviceNameFilter(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "force", "^web$"),
+			},
+			{
+				PreConfig: func() {
+					if err := server.AddECSService("test", "web", 1); err != nil {
+						t.Fatal(err)
+					}
+					if err := server.AddECSService("test", "keep", 2); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := server.AddECSTask("test", ""); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:      testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "force", "^web$"),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile(`its services keep don't match service_name_filter "\^web\$"`),
+			},
+			{
+				// Nothing is changed when the cluster can't be deleted
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "force", "^web$"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 0, 2, 4),
+					testAccCheckDashsoftAwsEcsClusterServiceTasks(provider, "test", "keep", 2),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "force", ""),
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsEcsCluster_scaleOnly(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsEcsClusterDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "scale_only", ""),
+			},
+			{
+				PreConfig: func() {
+					if err := server.AddECSService("test", "web", 2); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := server.AddECSTask("test", ""); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:      testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "scale_only", ""),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("service_deletion_policy is scale_only and the services web, now scaled down"),
+			},
+			{
+				// The service is scaled down, and the delete stops before
+				// stopping the task started outside of it
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "scale_only", ""),
+				Check:  testAccCheckDashsoftAwsEcsClusterCounts(provider, "test", 0, 1, 1),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsEcsClusterConfigServices, "force", ""),
+			},
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsEcsClusterExists(provider *schema.Provider, name string, cluster *ecs.Cluster) resource.TestCheckFunc {
+	return testAccCheckResourceExists(name, func(id string) error {
+		out, err := testAccClient(provider).ecsconn().DescribeClusters(&ecs.DescribeClustersInput{
+			Clusters: []*string{aws.String(id)},
+			Include:  aws.StringSlice([]string{ecs.ClusterFieldSettings, ecs.ClusterFieldTags}),
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range out.Clusters {
+			if aws.StringValue(c.Status) == "ACTIVE" {
+				*cluster = *c
+				return nil
+			}
+		}
+		return fmt.Errorf("ECS cluster %s not found", id)
+	})
+}
+
+func testAccCheckDashsoftAwsEcsClusterSetting(cluster *ecs.Cluster, name, value string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		for _, setting := range cluster.Settings {
+			if aws.StringValue(setting.Name) == name {
+				if aws.StringValue(setting.Value) != value {
+					return fmt.Errorf("Expected setting %s to be %q, got %q", name, value, aws.StringValue(setting.Value))
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("Setting %s not found", name)
+	}
+}
+
+func testAccCheckDashsoftAwsEcsClusterStrategy(cluster *ecs.Cluster, capacityProvider string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		strategy := cluster.DefaultCapacityProviderStrategy
+		if len(strategy) != 1 || aws.StringValue(strategy[0].CapacityProvider) != capacityProvider {
+			return fmt.Errorf("Expected the default capacity provider strategy to use %s, got %s", capacityProvider, strategy)
+		}
+		return nil
+	}
+}
+
+// testAccCheckDashsoftAwsEcsClusterCounts checks the number of container
+// instances, active services and running tasks of the cluster, which ECS
+// still reports once it is INACTIVE.
+func testAccCheckDashsoftAwsEcsClusterCounts(provider *schema.Provider, name string, instances, services, tasks int64) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		out, err := testAccClient(provider).ecsconn().DescribeClusters(&ecs.DescribeClustersInput{
+			Clusters: []*string{aws.String(name)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Clusters) != 1 {
+			return fmt.Errorf("ECS cluster %s not found", name)
+		}
+		c := out.Clusters[0]
+		if aws.Int64Value(c.RegisteredContainerInstancesCount) != instances || aws.Int64Value(c.ActiveServicesCount) != services ||
+			aws.Int64Value(c.RunningTasksCount) != tasks {
+			return fmt.Errorf("Expected ECS cluster %s to have %d container instances, %d services and %d tasks, got %d, %d and %d",
+				name, instances, services, tasks, aws.Int64Value(c.RegisteredContainerInstancesCount),
+				aws.Int64Value(c.ActiveServicesCount), aws.Int64Value(c.RunningTasksCount))
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsEcsClusterServiceTasks(provider *schema.Provider, name, serviceName string, running int) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		conn := testAccClient(provider).ecsconn()
+		for _, desiredStatus := range []string{ecs.DesiredStatusRunning, ecs.DesiredStatusStopped} {
+			out, err := conn.ListTasks(&ecs.ListTasksInput{
+				Cluster:       aws.String(name),
+				ServiceName:   aws.String(serviceName),
+				DesiredStatus: aws.String(desiredStatus),
+			})
+			if err != nil {
+				return err
+			}
+			expected := running
+			if desiredStatus == ecs.DesiredStatusStopped {
+				expected = 0
+			}
+			if len(out.TaskArns) != expected {
+				return fmt.Errorf("Expected service %s of ECS cluster %s to have %d %s tasks, got %d",
+					serviceName, name, expected, desiredStatus, len(out.TaskArns))
+			}
+		}
+		return nil
+	}
+}
+
+// testAccReadAuditLog returns the records of the audit log at path.
+func testAccReadAuditLog(path string) ([]auditRecord, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record auditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("Error decoding audit log record %q: %s", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func testAccCheckDashsoftAwsEcsClusterAuditOperations(path string, operations ...string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		records, err := testAccReadAuditLog(path)
+		if err != nil {
+			return err
+		}
+
+		var logged []string
+		for _, record := range records {
+			logged = append(logged, record.Operation)
+		}
+		if !reflect.DeepEqual(logged, operations) {
+			return fmt.Errorf("Expected the audit log to record %v, got %v", operations, logged)
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsEcsClusterServicesAudit(path, operation string, services ...string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		records, err := testAccReadAuditLog(path)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if record.Operation != operation {
+				continue
+			}
+			parameters, _ := record.Parameters.(map[string]interface{})
+			serviceArns, _ := parameters["services"].([]interface{})
+			var names []string
+			for _, serviceArn := range serviceArns {
+				names = append(names, ecsServiceName(serviceArn.(string)))
+			}
+			if record.Outcome != "success" || !reflect.DeepEqual(names, services) {
+				return fmt.Errorf("Expected a successful %s record of the services %v, got %s of %v", operation, services, record.Outcome, names)
+			}
+			return nil
+		}
+		return fmt.Errorf("No %s record in the audit log", operation)
+	}
+}
+
+func testAccCheckDashsoftAwsEcsClusterDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_ecs_cluster", func(id string, _ map[string]string) error {
+		out, err := testAccClient(provider).ecsconn().DescribeClusters(&ecs.DescribeClustersInput{
+			Clusters: []*string{aws.String(id)},
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range out.Clusters {
+			if aws.StringValue(c.Status) != "INACTIVE" {
+				return fmt.Errorf("ECS cluster %s is still %s", id, aws.StringValue(c.Status))
+			}
+		}
+		return nil
+	})
+}
+
+const testAccDashsoftAwsEcsClusterConfig = `
+resource "dashsoftaws_ecs_cluster" "test" {
+  name               = "test"
+  capacity_providers = ["FARGATE", "FARGATE_SPOT"]
+
+  setting {
+    name  = "containerInsights"
+    value = %q
+  }
+
+  default_capacity_provider_strategy {
+    capacity_provider = %q
+    weight            = 1
+  }
+
+  tags {
+    color = %q
+  }
+}
+`
+
+const testAccDashsoftAwsEcsClusterConfigForceDeregister = `
+resource "dashsoftaws_ecs_cluster" "test" {
+  name                       = "test"
+  force_deregister_instances = true
+}
+`
+
+const testAccDashsoftAwsEcsClusterConfigDeletionProtection = `
+resource "dashsoftaws_ecs_cluster" "test" {
+  name                = "test"
+  deletion_protection = %t
+}
+`
+
+const testAccDashsoftAwsEcsClusterConfigServices = `
+resource "dashsoftaws_ecs_cluster" "test" {
+  name                    = "test"
+  service_deletion_policy = %q
+  service_name_filter     = %q
+}
+`
+
+const testAccDashsoftAwsEcsClusterConfigDeleteTimeout = `
+resource "dashsoftaws_ecs_cluster" "test" {
+  name = "test"
+
+  timeouts {
+    delete = %q
+  }
+}
+`
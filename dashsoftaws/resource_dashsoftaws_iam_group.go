@@ -1,7 +1,8 @@
 package dashsoftaws
 
 import (
-	"fmt"
+	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -16,6 +17,15 @@ func resourceDashsoftAwsIamGroup() *schema.Resource {
 		Read:   resourceDashsoftAwsIamGroupRead,
 		Update: resourceDashsoftAwsIamGroupUpdate,
 		Delete: resourceDashsoftAwsIamGroupDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceDashsoftAwsIamGroupImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"arn": &schema.Schema{
@@ -35,12 +45,13 @@ func resourceDashsoftAwsIamGroup() *schema.Resource {
 				Optional: true,
 				Default:  "/",
 			},
+			"deletion_protection": deletionProtectionSchema(),
 		},
 	}
 }
 
 func resourceDashsoftAwsIamGroupCreate(d *schema.ResourceData, meta interface{}) error {
-	iamconn := meta.(*AWSClient).iamconn
+	iamconn := meta.(*AWSClient).iamconn()
 	name := d.Get("name").(string)
 	path := d.Get("path").(string)
 
@@ -49,19 +60,21 @@ func resourceDashsoftAwsIamGroupCreate(d *schema.ResourceData, meta interface{})
 		GroupName: aws.String(name),
 	}
 
-	createResp, err := iamconn.CreateGroup(request)
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	createResp, err := iamconn.CreateGroupWithContext(ctx, request)
 	if err != nil {
-		return fmt.Errorf("Error creating IAM Group %s: %s", name, err)
+		return awsError("dashsoftaws_iam_group", name, "CreateGroup", err)
 	}
 	return resourceDashsoftAwsIamGroupReadResult(d, createResp.Group)
 }
 
 func resourceDashsoftAwsIamGroupRead(d *schema.ResourceData, meta interface{}) error {
-	iamconn := meta.(*AWSClient).iamconn
-	name := d.Get("name").(string)
+	iamconn := meta.(*AWSClient).iamconn()
 
 	request := &iam.GetGroupInput{
-		GroupName: aws.String(name),
+		GroupName: aws.String(d.Id()),
 	}
 
 	getResp, err := iamconn.GetGroup(request)
@@ -70,7 +83,7 @@ func resourceDashsoftAwsIamGroupRead(d *schema.ResourceData, meta interface{}) e
 			d.SetId("")
 			return nil
 		}
-		return fmt.Errorf("Error reading IAM Group %s: %s", d.Id(), err)
+		return awsError("dashsoftaws_iam_group", d.Id(), "GetGroup", err)
 	}
 	return resourceDashsoftAwsIamGroupReadResult(d, getResp.Group)
 }
@@ -94,7 +107,7 @@ func resourceDashsoftAwsIamGroupReadResult(d *schema.ResourceData, group *iam.Gr
 
 func resourceDashsoftAwsIamGroupUpdate(d *schema.ResourceData, meta interface{}) error {
 	if d.HasChange("name") || d.HasChange("path") {
-		iamconn := meta.(*AWSClient).iamconn
+		iamconn := meta.(*AWSClient).iamconn()
 		on, nn := d.GetChange("name")
 		_, np := d.GetChange("path")
 
@@ -103,32 +116,49 @@ func resourceDashsoftAwsIamGroupUpdate(d *schema.ResourceData, meta interface{})
 			NewGroupName: aws.String(nn.(string)),
 			NewPath:      aws.String(np.(string)),
 		}
-		_, err := iamconn.UpdateGroup(request)
+		ctx, cancel := timeoutContext(d, schema.TimeoutUpdate)
+		defer cancel()
+
+		_, err := iamconn.UpdateGroupWithContext(ctx, request)
 		if err != nil {
-			return fmt.Errorf("Error updating IAM Group %s: %s", d.Id(), err)
+			return awsError("dashsoftaws_iam_group", d.Id(), "UpdateGroup", err)
 		}
+		// The ID is the name, which may just have changed
+		d.SetId(nn.(string))
 		return resourceDashsoftAwsIamGroupRead(d, meta)
 	}
 	return nil
 }
 
 func resourceDashsoftAwsIamGroupDelete(d *schema.ResourceData, meta interface{}) error {
-	iamconn := meta.(*AWSClient).iamconn
+	iamconn := meta.(*AWSClient).iamconn()
+
+	if err := checkDeletionAllowed(d, meta, "IAM Group", d.Id()); err != nil {
+		return err
+	}
 
-	groupResp, groupErr := iamconn.GetGroup(&iam.GetGroupInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	var users []*iam.User
+	groupErr := iamconn.GetGroupPagesWithContext(ctx, &iam.GetGroupInput{
 		GroupName: aws.String(d.Id()),
+	}, func(page *iam.GetGroupOutput, lastPage bool) bool {
+		users = append(users, page.Users...)
+		return true
 	})
 
 	if groupErr != nil {
-		return fmt.Errorf("Could not get IAM Group %s: %s", d.Id(), groupErr)
+		return awsError("dashsoftaws_iam_group", d.Id(), "GetGroup", groupErr)
 	} else {
-		for _, user := range groupResp.Users {
+		for _, user := range users {
+			log.Printf("[DEBUG] Removing user %s from IAM Group %s", *user.UserName, d.Id())
 			removeUserInput := &iam.RemoveUserFromGroupInput{
 				UserName:  aws.String(*user.UserName),
 				GroupName: aws.String(d.Id()),
 			}
-			if _, removeUserErr := iamconn.RemoveUserFromGroup(removeUserInput); removeUserErr != nil {
-				return fmt.Errorf("Error removing user %s from group %s: %s", *user.UserName, d.Id(), removeUserErr)
+			if _, removeUserErr := iamconn.RemoveUserFromGroupWithContext(ctx, removeUserInput); removeUserErr != nil {
+				return awsError("dashsoftaws_iam_group", d.Id(), "RemoveUserFromGroup", removeUserErr)
 			}
 		}
 	}
@@ -137,8 +167,15 @@ func resourceDashsoftAwsIamGroupDelete(d *schema.ResourceData, meta interface{})
 		GroupName: aws.String(d.Id()),
 	}
 
-	if _, err := iamconn.DeleteGroup(request); err != nil {
-		return fmt.Errorf("Error deleting IAM Group %s: %s", d.Id(), err)
+	if _, err := iamconn.DeleteGroupWithContext(ctx, request); err != nil {
+		return awsError("dashsoftaws_iam_group", d.Id(), "DeleteGroup", err)
 	}
 	return nil
 }
+
+// resourceDashsoftAwsIamGroupImport imports a group by its name.
+// deletion_protection is not stored in AWS, so it gets its default.
+func resourceDashsoftAwsIamGroupImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	d.Set("deletion_protection", false)
+	return []*schema.ResourceData{d}, nil
+}
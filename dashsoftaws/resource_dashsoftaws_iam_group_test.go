@@ -0,0 +1,219 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsIamGroup_basic(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	var group iam.Group
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsIamGroupDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsIamGroupConfig, "test", "/"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsIamGroupExists(provider, "dashsoftaws_iam_group.test", &group),
+					testAccCheckDashsoftAwsIamGroupAttributes(&group, "test", "/"),
+					resource.TestCheckResourceAttr("dashsoftaws_iam_group.test", "name", "test"),
+					resource.TestCheckResourceAttr("dashsoftaws_iam_group.test", "path", "/"),
+					resource.TestCheckResourceAttrSet("dashsoftaws_iam_group.test", "arn"),
+					resource.TestCheckResourceAttrSet("dashsoftaws_iam_group.test", "unique_id"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsIamGroupConfig, "renamed", "/team/"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsIamGroupExists(provider, "dashsoftaws_iam_group.test", &group),
+					testAccCheckDashsoftAwsIamGroupAttributes(&group, "renamed", "/team/"),
+					resource.TestCheckResourceAttr("dashsoftaws_iam_group.test", "name", "renamed"),
+					resource.TestCheckResourceAttr("dashsoftaws_iam_group.test", "path", "/team/"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				// Members of the group are removed before it is deleted
+				PreConfig: func() {
+					if err := server.AddIAMUser("alice", "renamed"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:            testAccConfig(server, testAccDashsoftAwsIamGroupConfig, "renamed", "/team/"),
+				ResourceName:      "dashsoftaws_iam_group.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+			}),
+		},
+	})
+}
+
+func TestAccDashsoftAwsIamGroup_deletionProtection(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsIamGroupDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsIamGroupConfigDeletionProtection, true),
+				Check:  resource.TestCheckResourceAttr("dashsoftaws_iam_group.test", "deletion_protection", "true"),
+			},
+			{
+				Config:      testAccConfig(server, testAccDashsoftAwsIamGroupConfigDeletionProtection, true),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("Refusing to delete IAM Group test: deletion_protection is set"),
+			},
+			{
+				// A destroy that was not refused would leave a plan creating
+				// the group again
+				Config:   testAccConfig(server, testAccDashsoftAwsIamGroupConfigDeletionProtection, true),
+				PlanOnly: true,
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsIamGroupConfigDeletionProtection, false),
+				Check:  testAccCheckDashsoftAwsIamGroupExists(provider, "dashsoftaws_iam_group.test", &iam.Group{}),
+			},
+		},
+	})
+}
+
+func TestAccDashsoftAwsIamGroup_protectedResourcePatterns(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsIamGroupDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfigProvider(server, `  protected_resource_patterns = ["prod-*"]`, testAccDashsoftAwsIamGroupConfig, "prod-admins", "/"),
+			},
+			{
+				Config:      testAccConfigProvider(server, `  protected_resource_patterns = ["prod-*"]`, testAccDashsoftAwsIamGroupConfig, "prod-admins", "/"),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile(`Refusing to delete IAM Group prod-admins: the name matches "prod-\*" of protected_resource_patterns`),
+			},
+			{
+				Config:   testAccConfigProvider(server, `  protected_resource_patterns = ["prod-*"]`, testAccDashsoftAwsIamGroupConfig, "prod-admins", "/"),
+				PlanOnly: true,
+			},
+			{
+				// Patterns that don't match leave the group deletable
+				Config: testAccConfigProvider(server, `  protected_resource_patterns = ["/^staging-/"]`, testAccDashsoftAwsIamGroupConfig, "prod-admins", "/"),
+				Check:  testAccCheckDashsoftAwsIamGroupExists(provider, "dashsoftaws_iam_group.test", &iam.Group{}),
+			},
+		},
+	})
+}
+
+// Deleting a group removes every member, beyond the first page of GetGroup.
+func TestAccDashsoftAwsIamGroup_manyMembers(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsIamGroupDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsIamGroupConfig, "test", "/"),
+			},
+			{
+				PreConfig: func() {
+					for i := 0; i < 250; i++ {
+						if err := server.AddIAMUser(fmt.Sprintf("user-%03d", i), "test"); err != nil {
+							t.Fatal(err)
+						}
+					}
+				},
+				Config: testAccConfig(server, testAccDashsoftAwsIamGroupConfig, "test", "/"),
+				Check:  testAccCheckDashsoftAwsIamGroupMembers(provider, "test", 250),
+			},
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsIamGroupExists(provider *schema.Provider, name string, group *iam.Group) resource.TestCheckFunc {
+	return testAccCheckResourceExists(name, func(id string) error {
+		out, err := testAccClient(provider).iamconn().GetGroup(&iam.GetGroupInput{
+			GroupName: aws.String(id),
+		})
+		if err != nil {
+			return err
+		}
+		*group = *out.Group
+		return nil
+	})
+}
+
+func testAccCheckDashsoftAwsIamGroupAttributes(group *iam.Group, name, path string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		if aws.StringValue(group.GroupName) != name {
+			return fmt.Errorf("Expected group name %q, got %q", name, aws.StringValue(group.GroupName))
+		}
+		if aws.StringValue(group.Path) != path {
+			return fmt.Errorf("Expected group path %q, got %q", path, aws.StringValue(group.Path))
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsIamGroupMembers(provider *schema.Provider, name string, members int) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		var users []*iam.User
+		err := testAccClient(provider).iamconn().GetGroupPages(&iam.GetGroupInput{
+			GroupName: aws.String(name),
+		}, func(page *iam.GetGroupOutput, lastPage bool) bool {
+			users = append(users, page.Users...)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if len(users) != members {
+			return fmt.Errorf("Expected IAM Group %s to have %d members, got %d", name, members, len(users))
+		}
+		return nil
+	}
+}
+
+func testAccCheckDashsoftAwsIamGroupDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_iam_group", func(id string, _ map[string]string) error {
+		_, err := testAccClient(provider).iamconn().GetGroup(&iam.GetGroupInput{
+			GroupName: aws.String(id),
+		})
+		if err == nil {
+			return fmt.Errorf("IAM Group %s still exists", id)
+		}
+		if testAccErrorCode(err) != "NoSuchEntity" {
+			return err
+		}
+		return nil
+	})
+}
+
+const testAccDashsoftAwsIamGroupConfig = `
+resource "dashsoftaws_iam_group" "test" {
+  name = %q
+  path = %q
+}
+`
+
+const testAccDashsoftAwsIamGroupConfigDeletionProtection = `
+resource "dashsoftaws_iam_group" "test" {
+  name                = "test"
+  deletion_protection = %t
+}
+`
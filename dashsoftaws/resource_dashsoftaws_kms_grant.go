@@ -1,10 +1,11 @@
 package dashsoftaws
 
 import (
-	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -15,6 +16,14 @@ func resourceDashsoftAwsKMSGrant() *schema.Resource {
 		Read:   resourceDashsoftAwsKMSGrantRead,
 		//		Update: resourceDashsoftAwsKMSGrantUpdate,
 		Delete: resourceDashsoftAwsKMSGrantDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceDashsoftAwsKMSGrantImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"granteeprincipal": &schema.Schema{
@@ -32,13 +41,17 @@ func resourceDashsoftAwsKMSGrant() *schema.Resource {
 				ForceNew: true,
 				Optional: true,
 				Elem: &schema.Resource{
+					// A changed context shows in the diff of its map rather
+					// than of the set, so the maps replace the grant too
 					Schema: map[string]*schema.Schema{
 						"encryptioncontextequals": &schema.Schema{
 							Type:     schema.TypeMap,
+							ForceNew: true,
 							Optional: true,
 						},
 						"encryptioncontextsubset": &schema.Schema{
 							Type:     schema.TypeMap,
+							ForceNew: true,
 							Optional: true,
 						},
 					},
@@ -49,17 +62,27 @@ func resourceDashsoftAwsKMSGrant() *schema.Resource {
 				ForceNew: true,
 				Optional: true,
 				Elem:     &schema.Schema{Type: schema.TypeString},
+				// Grant tokens only make the grants they were issued for
+				// usable by CreateGrant before they have propagated, and are
+				// not part of the grant, so an imported grant has none
+				// stored, which must not replace it
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return d.Id() != "" && old == ""
+				},
 			},
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
 				ForceNew: true,
 				Optional: true,
 			},
+			// ListGrants returns the operations in an order of its own,
+			// which must not replace the grant
 			"operations": &schema.Schema{
-				Type:     schema.TypeList,
+				Type:     schema.TypeSet,
 				ForceNew: true,
 				Optional: true,
 				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
 			},
 			"retiringprincipal": &schema.Schema{
 				Type:     schema.TypeString,
@@ -76,7 +99,7 @@ func resourceDashsoftAwsKMSGrant() *schema.Resource {
 }
 
 func resourceDashsoftAwsKMSGrantCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).kmsconn
+	conn := meta.(*AWSClient).kmsconn()
 
 	granteePrincipal := d.Get("granteeprincipal").(string)
 	keyId := d.Get("keyid").(string)
@@ -89,8 +112,7 @@ func resourceDashsoftAwsKMSGrantCreate(d *schema.ResourceData, meta interface{})
 	}
 
 	if v, ok := d.GetOk("constraints"); ok {
-		input.Constraints = &kms.GrantConstraints{}
-		log.Printf("[DEBUG] This is how constraints look %#v", v)
+		input.Constraints = expandKMSGrantConstraints(v.(*schema.Set).List())
 	}
 
 	if v, ok := d.GetOk("granttokens"); ok {
@@ -98,7 +120,7 @@ func resourceDashsoftAwsKMSGrantCreate(d *schema.ResourceData, meta interface{})
 	}
 
 	if v, ok := d.GetOk("operations"); ok {
-		input.Operations = makeAwsStringList(v.([]interface{}))
+		input.Operations = makeAwsStringList(v.(*schema.Set).List())
 	}
 
 	if v, ok := d.GetOk("name"); ok {
@@ -109,9 +131,12 @@ func resourceDashsoftAwsKMSGrantCreate(d *schema.ResourceData, meta interface{})
 		input.RetiringPrincipal = aws.String(v.(string))
 	}
 
-	out, err := conn.CreateGrant(input)
+	ctx, cancel := timeoutContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	out, err := conn.CreateGrantWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("Error creating KMS Grant: %s", err)
+		return awsError("dashsoftaws_kms_grant", keyId, "CreateGrant", err)
 	}
 	log.Printf("[DEBUG] KMS Grant created")
 
@@ -121,30 +146,94 @@ func resourceDashsoftAwsKMSGrantCreate(d *schema.ResourceData, meta interface{})
 }
 
 func resourceDashsoftAwsKMSGrantRead(d *schema.ResourceData, meta interface{}) error {
-	//	conn := meta.(*AWSClient).kmsconn
-	//
-	//	domainName, basePath := resourceDashsoftAwsKMSGrantParseId(d.Id())
-	//
-	//	log.Printf("[DEBUG] Reading KMS Grant ID %s", d.Id())
-	//	out, err := conn.ListGrants(&kms.ListGrantsInput{
-	//		BasePath:   aws.String(basePath),
-	//		DomainName: aws.String(domainName),
-	//	})
-	//	if err != nil {
-	//		return err
-	//	}
-	//	log.Printf("[DEBUG] Received KMS Grant %s for domain %s", *out.BasePath, domainName)
-	//
-	//	if v, ok := d.GetOk("basepath"); ok {
-	//		d.Set("basepath", aws.String(v.(string)))
-	//	} else {
-	//		d.Set("basepath", aws.String(""))
-	//	}
-	//
-	//	d.SetId(fmt.Sprintf("%s:%s", domainName, *out.BasePath))
+	conn := meta.(*AWSClient).kmsconn()
+
+	keyId := d.Get("keyid").(string)
+
+	log.Printf("[DEBUG] Reading KMS Grant %s for key %s", d.Id(), keyId)
+
+	var grant *kms.GrantListEntry
+	err := conn.ListGrantsPages(&kms.ListGrantsInput{
+		KeyId: aws.String(keyId),
+	}, func(page *kms.ListGrantsResponse, lastPage bool) bool {
+		for _, g := range page.Grants {
+			if *g.GrantId == d.Id() {
+				grant = g
+				return false
+			}
+		}
+		return !lastPage
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotFoundException" {
+			log.Printf("[WARN] KMS key %s not found, removing KMS Grant %s from state", keyId, d.Id())
+			d.SetId("")
+			return nil
+		}
+		return awsError("dashsoftaws_kms_grant", keyId+":"+d.Id(), "ListGrants", err)
+	}
+
+	if grant == nil {
+		log.Printf("[WARN] KMS Grant %s not found for key %s, removing from state", d.Id(), keyId)
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("granteeprincipal", grant.GranteePrincipal)
+	d.Set("retiringprincipal", grant.RetiringPrincipal)
+	d.Set("name", grant.Name)
+	if err := d.Set("operations", aws.StringValueSlice(grant.Operations)); err != nil {
+		return err
+	}
+	if err := d.Set("constraints", flattenKMSGrantConstraints(grant.Constraints)); err != nil {
+		return err
+	}
 	return nil
 }
 
+// resourceDashsoftAwsKMSGrantImport takes an ID of the form keyid:grantid,
+// as grants can only be listed by key.
+func resourceDashsoftAwsKMSGrantImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts, err := parseImportId(d.Id(), "keyid:grantid")
+	if err != nil {
+		return nil, err
+	}
+
+	d.Set("keyid", parts[0])
+	d.SetId(parts[1])
+	return []*schema.ResourceData{d}, nil
+}
+
+func expandKMSGrantConstraints(configured []interface{}) *kms.GrantConstraints {
+	constraints := &kms.GrantConstraints{}
+	for _, raw := range configured {
+		if raw == nil {
+			continue
+		}
+		m := raw.(map[string]interface{})
+		if v, ok := m["encryptioncontextequals"].(map[string]interface{}); ok && len(v) > 0 {
+			constraints.EncryptionContextEquals = stringMapToPointers(v)
+		}
+		if v, ok := m["encryptioncontextsubset"].(map[string]interface{}); ok && len(v) > 0 {
+			constraints.EncryptionContextSubset = stringMapToPointers(v)
+		}
+	}
+	return constraints
+}
+
+func flattenKMSGrantConstraints(constraints *kms.GrantConstraints) []interface{} {
+	if constraints == nil || (len(constraints.EncryptionContextEquals) == 0 && len(constraints.EncryptionContextSubset) == 0) {
+		return []interface{}{}
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"encryptioncontextequals": pointersMapToStringList(constraints.EncryptionContextEquals),
+			"encryptioncontextsubset": pointersMapToStringList(constraints.EncryptionContextSubset),
+		},
+	}
+}
+
 //func resourceDashsoftAwsKMSGrantUpdate(d *schema.ResourceData, meta interface{}) error {
 //	conn := meta.(*AWSClient).kmsconn
 //
@@ -199,19 +288,22 @@ func resourceDashsoftAwsKMSGrantRead(d *schema.ResourceData, meta interface{}) e
 //}
 
 func resourceDashsoftAwsKMSGrantDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*AWSClient).kmsconn
+	conn := meta.(*AWSClient).kmsconn()
 
 	grantId := d.Id()
 	keyId := d.Get("keyid").(string)
 
 	log.Printf("[DEBUG] Revoke KMS Grant %s", d.Id())
 
-	_, err := conn.RevokeGrant(&kms.RevokeGrantInput{
+	ctx, cancel := timeoutContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	_, err := conn.RevokeGrantWithContext(ctx, &kms.RevokeGrantInput{
 		KeyId:   aws.String(keyId),
 		GrantId: aws.String(grantId),
 	})
 	if err != nil {
-		return fmt.Errorf("Error revoked KMS Grant: %s", err)
+		return awsError("dashsoftaws_kms_grant", keyId+":"+d.Id(), "RevokeGrant", err)
 	}
 	log.Println("[INFO] KMS Grant revoked")
 
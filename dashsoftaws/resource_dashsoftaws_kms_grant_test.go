@@ -0,0 +1,214 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccDashsoftAwsKMSGrant_basic(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+	server.AddKMSKey("1234abcd-12ab-34cd-56ef-1234567890ab")
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsKMSGrantDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsKMSGrantConfig),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsKMSGrantExists(provider, "dashsoftaws_kms_grant.test"),
+					resource.TestCheckResourceAttr("dashsoftaws_kms_grant.test", "name", "test"),
+					resource.TestCheckResourceAttr("dashsoftaws_kms_grant.test", "operations.#", "2"),
+					resource.TestCheckResourceAttr("dashsoftaws_kms_grant.test", "constraints.#", "1"),
+					resource.TestCheckResourceAttrSet("dashsoftaws_kms_grant.test", "token"),
+				),
+			},
+			testAccImportStep(provider, resource.TestStep{
+				Config:              testAccConfig(server, testAccDashsoftAwsKMSGrantConfig),
+				ResourceName:        "dashsoftaws_kms_grant.test",
+				ImportState:         true,
+				ImportStateIdPrefix: "1234abcd-12ab-34cd-56ef-1234567890ab:",
+				ImportStateVerify:   true,
+				// The grant token is only returned by CreateGrant
+				ImportStateVerifyIgnore: []string{"token"},
+			}),
+		},
+	})
+}
+
+// Changing the grant tokens or the constraints of a grant replaces it.
+func TestAccDashsoftAwsKMSGrant_replace(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+	server.AddKMSKey("1234abcd-12ab-34cd-56ef-1234567890ab")
+
+	var grantIds []string
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsKMSGrantDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsKMSGrantConfigTokens, "first-token", "finance"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsKMSGrantExists(provider, "dashsoftaws_kms_grant.test"),
+					testAccCheckDashsoftAwsKMSGrantReplaced("dashsoftaws_kms_grant.test", &grantIds),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsKMSGrantConfigTokens, "second-token", "finance"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsKMSGrantExists(provider, "dashsoftaws_kms_grant.test"),
+					testAccCheckDashsoftAwsKMSGrantReplaced("dashsoftaws_kms_grant.test", &grantIds),
+					resource.TestCheckResourceAttr("dashsoftaws_kms_grant.test", "granttokens.0", "second-token"),
+				),
+			},
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsKMSGrantConfigTokens, "second-token", "sales"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsKMSGrantExists(provider, "dashsoftaws_kms_grant.test"),
+					testAccCheckDashsoftAwsKMSGrantReplaced("dashsoftaws_kms_grant.test", &grantIds),
+				),
+			},
+			// An imported grant has no grant tokens stored
+			testAccImportStep(provider, resource.TestStep{
+				Config:                  testAccConfig(server, testAccDashsoftAwsKMSGrantConfigTokens, "second-token", "sales"),
+				ResourceName:            "dashsoftaws_kms_grant.test",
+				ImportState:             true,
+				ImportStateIdPrefix:     "1234abcd-12ab-34cd-56ef-1234567890ab:",
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"token", "granttokens"},
+			}),
+		},
+	})
+}
+
+// Grants beyond the first page of ListGrants are found.
+func TestAccDashsoftAwsKMSGrant_manyGrants(t *testing.T) {
+	server, provider, providers := testAccFakeAWS()
+	defer server.Close()
+	server.AddKMSKey("1234abcd-12ab-34cd-56ef-1234567890ab")
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    providers,
+		CheckDestroy: testAccCheckDashsoftAwsKMSGrantDestroy(provider),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccConfig(server, testAccDashsoftAwsKMSGrantConfigCount, 120),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDashsoftAwsKMSGrantExists(provider, "dashsoftaws_kms_grant.test.0"),
+					testAccCheckDashsoftAwsKMSGrantExists(provider, "dashsoftaws_kms_grant.test.119"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckDashsoftAwsKMSGrantExists(provider *schema.Provider, name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+
+		grant, err := testAccFindKMSGrant(provider, rs.Primary.Attributes["keyid"], rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		if grant == nil {
+			return fmt.Errorf("KMS Grant %s not found", rs.Primary.ID)
+		}
+		return nil
+	}
+}
+
+// testAccCheckDashsoftAwsKMSGrantReplaced checks that the grant has an ID
+// it did not have before, and adds it to grantIds.
+func testAccCheckDashsoftAwsKMSGrantReplaced(name string, grantIds *[]string) resource.TestCheckFunc {
+	return testAccCheckResourceExists(name, func(id string) error {
+		for _, grantId := range *grantIds {
+			if grantId == id {
+				return fmt.Errorf("Expected KMS Grant %s to be replaced", id)
+			}
+		}
+		*grantIds = append(*grantIds, id)
+		return nil
+	})
+}
+
+func testAccCheckDashsoftAwsKMSGrantDestroy(provider *schema.Provider) resource.TestCheckFunc {
+	return testAccCheckResourcesDestroyed("dashsoftaws_kms_grant", func(id string, attributes map[string]string) error {
+		grant, err := testAccFindKMSGrant(provider, attributes["keyid"], id)
+		if err != nil {
+			return err
+		}
+		if grant != nil {
+			return fmt.Errorf("KMS Grant %s still exists", id)
+		}
+		return nil
+	})
+}
+
+func testAccFindKMSGrant(provider *schema.Provider, keyId, grantId string) (*kms.GrantListEntry, error) {
+	var found *kms.GrantListEntry
+	err := testAccClient(provider).kmsconn().ListGrantsPages(&kms.ListGrantsInput{
+		KeyId: aws.String(keyId),
+	}, func(page *kms.ListGrantsResponse, lastPage bool) bool {
+		for _, grant := range page.Grants {
+			if aws.StringValue(grant.GrantId) == grantId {
+				found = grant
+				return false
+			}
+		}
+		return true
+	})
+	return found, err
+}
+
+const testAccDashsoftAwsKMSGrantConfig = `
+resource "dashsoftaws_kms_grant" "test" {
+  name             = "test"
+  keyid            = "1234abcd-12ab-34cd-56ef-1234567890ab"
+  granteeprincipal = "arn:aws:iam::123456789012:role/test"
+  operations       = ["Encrypt", "Decrypt"]
+
+  constraints {
+    encryptioncontextequals {
+      department = "finance"
+    }
+  }
+}
+`
+
+const testAccDashsoftAwsKMSGrantConfigCount = `
+resource "dashsoftaws_kms_grant" "test" {
+  count            = %d
+  name             = "test-${count.index}"
+  keyid            = "1234abcd-12ab-34cd-56ef-1234567890ab"
+  granteeprincipal = "arn:aws:iam::123456789012:role/test"
+  operations       = ["Decrypt"]
+}
+`
+
+const testAccDashsoftAwsKMSGrantConfigTokens = `
+resource "dashsoftaws_kms_grant" "test" {
+  name             = "test"
+  keyid            = "1234abcd-12ab-34cd-56ef-1234567890ab"
+  granteeprincipal = "arn:aws:iam::123456789012:role/test"
+  operations       = ["Decrypt"]
+  granttokens      = [%q]
+
+  constraints {
+    encryptioncontextequals {
+      department = %q
+    }
+  }
+}
+`
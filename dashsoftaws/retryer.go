@@ -0,0 +1,139 @@
+package dashsoftaws
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// retryableErrorCodes lists the error codes retried on top of the ones the
+// SDK already considers retryable, by service (as in ClientInfo.ServiceName)
+// and operation. The codes listed for the "" operation apply to every
+// operation of the service.
+var retryableErrorCodes = map[string]map[string][]string{
+	"dynamodb": {
+		// Throttled requests, and the limit of concurrent table operations
+		"": []string{
+			"ThrottlingException",
+			"ProvisionedThroughputExceededException",
+			"LimitExceededException",
+		},
+		// The table or one of its indexes is still being created or updated
+		"UpdateTable": []string{"ResourceInUseException"},
+		"DeleteTable": []string{"ResourceInUseException"},
+	},
+	"ecs": {
+		// Container instances, services and tasks take a while to go away
+		// after they have been deregistered, deleted or stopped. The delete of
+		// dashsoftaws_ecs_cluster calls DeleteCluster again once these
+		// retries are used up, until its timeout is over.
+		"DeleteCluster": []string{
+			"ClusterContainsContainerInstancesException",
+			"ClusterContainsServicesException",
+			"ClusterContainsTasksException",
+		},
+		// Capacity providers can't be changed while the previous change is
+		// being attached
+		"PutClusterCapacityProviders": []string{"UpdateInProgressException"},
+	},
+	"iam": {
+		"": []string{"ConcurrentModification"},
+	},
+	"kinesis": {
+		"": []string{"LimitExceededException"},
+	},
+	"logs": {
+		"": []string{"OperationAbortedException"},
+	},
+}
+
+// retryableErrorMessages lists error codes that are only retried when their
+// message contains one of the given strings, by service and operation, for
+// codes AWS also returns for errors that retrying can't fix.
+var retryableErrorMessages = map[string]map[string]map[string][]string{
+	"logs": {
+		// PutSubscriptionFilter delivers a test message to the destination,
+		// which fails until a new destination and the permission or role
+		// allowing CloudWatch Logs to use it have propagated. Any other
+		// invalid parameter is a configuration error.
+		"PutSubscriptionFilter": {
+			"InvalidParameterException": []string{
+				"Could not deliver test message to specified destination",
+				"Could not execute the lambda function",
+				"Could not assume role",
+			},
+		},
+	},
+}
+
+// awsRetryer is the request.Retryer installed on the base session, so every
+// service client shares the same retry policy. Retries back off exponentially
+// with full jitter: the n-th retry waits a random duration between zero and
+// the smaller of MaxRetryDelay and BaseRetryDelay * 2^n.
+type awsRetryer struct {
+	NumMaxRetries  int
+	BaseRetryDelay time.Duration
+	MaxRetryDelay  time.Duration
+}
+
+func (r awsRetryer) MaxRetries() int {
+	return r.NumMaxRetries
+}
+
+func (r awsRetryer) ShouldRetry(req *request.Request) bool {
+	if awsErr, ok := req.Error.(awserr.Error); ok {
+		if isRetryableErrorCode(req.ClientInfo.ServiceName, req.Operation.Name, awsErr.Code()) ||
+			isRetryableErrorMessage(req.ClientInfo.ServiceName, req.Operation.Name, awsErr.Code(), awsErr.Message()) {
+			log.Printf("[DEBUG] Retrying %s.%s after %s (attempt %d/%d)",
+				req.ClientInfo.ServiceName, req.Operation.Name, awsErr.Code(), req.RetryCount+1, r.NumMaxRetries)
+			return true
+		}
+	}
+
+	return req.IsErrorRetryable() || req.IsErrorThrottle()
+}
+
+func (r awsRetryer) RetryRules(req *request.Request) time.Duration {
+	ceiling := r.MaxRetryDelay
+	if req.RetryCount < 32 {
+		if delay := r.BaseRetryDelay << uint(req.RetryCount); delay > 0 && delay < ceiling {
+			ceiling = delay
+		}
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func isRetryableErrorCode(service, operation, code string) bool {
+	operations, ok := retryableErrorCodes[service]
+	if !ok {
+		return false
+	}
+
+	for _, op := range []string{"", operation} {
+		for _, retryable := range operations[op] {
+			if code == retryable {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isRetryableErrorMessage(service, operation, code, message string) bool {
+	for _, retryable := range retryableErrorMessages[service][operation][code] {
+		if strings.Contains(message, retryable) {
+			return true
+		}
+	}
+	return false
+}
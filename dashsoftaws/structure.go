@@ -1,6 +1,9 @@
 package dashsoftaws
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 )
 
@@ -11,3 +14,30 @@ func stringMapToPointers(m map[string]interface{}) map[string]*string {
 	}
 	return list
 }
+
+func pointersMapToStringList(pointers map[string]*string) map[string]interface{} {
+	list := make(map[string]interface{}, len(pointers))
+	for i, v := range pointers {
+		list[i] = *v
+	}
+	return list
+}
+
+// parseImportId splits the ID given to terraform import into the parts of a
+// colon separated format such as "keyid:grantid". The first part keeps any
+// extra colons, so it can be an ARN.
+func parseImportId(id string, format string) ([]string, error) {
+	count := len(strings.Split(format, ":"))
+	parts := strings.Split(id, ":")
+	if len(parts) < count {
+		return nil, fmt.Errorf("Unexpected format of ID (%s), expected %s", id, format)
+	}
+
+	parts = append([]string{strings.Join(parts[:len(parts)-count+1], ":")}, parts[len(parts)-count+1:]...)
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("Unexpected format of ID (%s), expected %s", id, format)
+		}
+	}
+	return parts, nil
+}
@@ -0,0 +1,295 @@
+package dashsoftaws
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// awsTagPrefix starts the keys of the tags AWS sets itself, which can't be
+// changed or removed.
+const awsTagPrefix = "aws:"
+
+// tagsSchema is the tags attribute of taggable resources, which holds the
+// tags of the resource on top of the default_tags of the provider.
+func tagsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Optional: true,
+	}
+}
+
+// tagsAllSchema is the tags_all attribute of taggable resources, which holds
+// all the tags of the resource, default_tags included.
+func tagsAllSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Computed: true,
+	}
+}
+
+// resourceTagger reads and changes the tags of one resource through the API
+// of its service.
+type resourceTagger struct {
+	listOperation string
+
+	list  func() (map[string]string, error)
+	tag   func(tags map[string]string) error
+	untag func(keys []string) error
+}
+
+// mergeTags returns the tags a resource should have: the default tags of the
+// provider, overridden by the tags of the resource.
+func mergeTags(defaultTags map[string]string, tags map[string]interface{}) map[string]string {
+	merged := make(map[string]string, len(defaultTags)+len(tags))
+	for key, value := range defaultTags {
+		merged[key] = value
+	}
+	for key, value := range tags {
+		merged[key] = value.(string)
+	}
+	return merged
+}
+
+// wantedTags returns the tags the resource should have on AWS.
+func wantedTags(d *schema.ResourceData, meta interface{}) map[string]string {
+	return mergeTags(meta.(*AWSClient).config.DefaultTags, d.Get("tags").(map[string]interface{}))
+}
+
+// diffTags returns the tags to set and the keys to remove to go from the
+// current tags to the wanted ones. Tags set by AWS are left alone.
+func diffTags(current, wanted map[string]string) (map[string]string, []string) {
+	set := make(map[string]string)
+	for key, value := range wanted {
+		if old, ok := current[key]; !ok || old != value {
+			set[key] = value
+		}
+	}
+
+	var remove []string
+	for key := range current {
+		if _, ok := wanted[key]; !ok && !strings.HasPrefix(key, awsTagPrefix) {
+			remove = append(remove, key)
+		}
+	}
+	sort.Strings(remove)
+
+	return set, remove
+}
+
+// resourceTags returns the tags attribute for the tags read from AWS: all of
+// them but the default tags that have their default value. A default tag
+// that is missing from AWS is kept as an empty tag, so that it shows up as a
+// change to apply, as do default tags with another value.
+func resourceTags(defaultTags map[string]string, current map[string]string, configured map[string]interface{}) map[string]string {
+	tags := make(map[string]string)
+	for key, value := range current {
+		if strings.HasPrefix(key, awsTagPrefix) {
+			continue
+		}
+		if defaultValue, ok := defaultTags[key]; ok && value == defaultValue {
+			if _, ok := configured[key]; !ok {
+				continue
+			}
+		}
+		tags[key] = value
+	}
+
+	for key := range defaultTags {
+		if _, ok := current[key]; !ok {
+			if _, ok := configured[key]; !ok {
+				tags[key] = ""
+			}
+		}
+	}
+
+	return tags
+}
+
+// setTags sets the tags and tags_all attributes from the tags of the
+// resource on AWS.
+func setTags(d *schema.ResourceData, meta interface{}, current map[string]string) error {
+	defaultTags := meta.(*AWSClient).config.DefaultTags
+	configured := d.Get("tags").(map[string]interface{})
+
+	if err := d.Set("tags", resourceTags(defaultTags, current, configured)); err != nil {
+		return err
+	}
+	return d.Set("tags_all", current)
+}
+
+// updateTags brings the tags of the resource on AWS to the default tags of
+// the provider merged with the tags attribute.
+func updateTags(d *schema.ResourceData, meta interface{}, resourceType string, tagger resourceTagger) error {
+	wanted := wantedTags(d, meta)
+
+	current, err := tagger.list()
+	if err != nil {
+		return awsError(resourceType, d.Id(), tagger.listOperation, err)
+	}
+
+	set, remove := diffTags(current, wanted)
+	if len(remove) > 0 {
+		log.Printf("[DEBUG] Removing tags %s from %s", remove, d.Id())
+		if err := tagger.untag(remove); err != nil {
+			return awsError(resourceType, d.Id(), "UntagResource", err)
+		}
+	}
+	if len(set) > 0 {
+		log.Printf("[DEBUG] Setting tags %v on %s", set, d.Id())
+		if err := tagger.tag(set); err != nil {
+			return awsError(resourceType, d.Id(), "TagResource", err)
+		}
+	}
+
+	return nil
+}
+
+func ecsTagger(conn *ecs.ECS, arn string) resourceTagger {
+	return resourceTagger{
+		listOperation: "ListTagsForResource",
+		list: func() (map[string]string, error) {
+			out, err := conn.ListTagsForResource(&ecs.ListTagsForResourceInput{
+				ResourceArn: aws.String(arn),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return ecsTagsToMap(out.Tags), nil
+		},
+		tag: func(tags map[string]string) error {
+			_, err := conn.TagResource(&ecs.TagResourceInput{
+				ResourceArn: aws.String(arn),
+				Tags:        ecsTags(tags),
+			})
+			return err
+		},
+		untag: func(keys []string) error {
+			_, err := conn.UntagResource(&ecs.UntagResourceInput{
+				ResourceArn: aws.String(arn),
+				TagKeys:     aws.StringSlice(keys),
+			})
+			return err
+		},
+	}
+}
+
+func ecsTags(tags map[string]string) []*ecs.Tag {
+	var result []*ecs.Tag
+	for key, value := range tags {
+		result = append(result, &ecs.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+	return result
+}
+
+func ecsTagsToMap(tags []*ecs.Tag) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		result[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return result
+}
+
+func dynamodbTagger(conn *dynamodb.DynamoDB, arn string) resourceTagger {
+	return resourceTagger{
+		listOperation: "ListTagsOfResource",
+		list: func() (map[string]string, error) {
+			result := make(map[string]string)
+			input := &dynamodb.ListTagsOfResourceInput{
+				ResourceArn: aws.String(arn),
+			}
+			for {
+				out, err := conn.ListTagsOfResource(input)
+				if err != nil {
+					return nil, err
+				}
+				for key, value := range dynamodbTagsToMap(out.Tags) {
+					result[key] = value
+				}
+				if out.NextToken == nil {
+					return result, nil
+				}
+				input.NextToken = out.NextToken
+			}
+		},
+		tag: func(tags map[string]string) error {
+			_, err := conn.TagResource(&dynamodb.TagResourceInput{
+				ResourceArn: aws.String(arn),
+				Tags:        dynamodbTags(tags),
+			})
+			return err
+		},
+		untag: func(keys []string) error {
+			_, err := conn.UntagResource(&dynamodb.UntagResourceInput{
+				ResourceArn: aws.String(arn),
+				TagKeys:     aws.StringSlice(keys),
+			})
+			return err
+		},
+	}
+}
+
+func dynamodbTags(tags map[string]string) []*dynamodb.Tag {
+	var result []*dynamodb.Tag
+	for key, value := range tags {
+		result = append(result, &dynamodb.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+	return result
+}
+
+func dynamodbTagsToMap(tags []*dynamodb.Tag) map[string]string {
+	result := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		result[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return result
+}
+
+func apigatewayTagger(conn *apigateway.APIGateway, arn string) resourceTagger {
+	return resourceTagger{
+		listOperation: "GetTags",
+		list: func() (map[string]string, error) {
+			out, err := conn.GetTags(&apigateway.GetTagsInput{
+				ResourceArn: aws.String(arn),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return aws.StringValueMap(out.Tags), nil
+		},
+		tag: func(tags map[string]string) error {
+			_, err := conn.TagResource(&apigateway.TagResourceInput{
+				ResourceArn: aws.String(arn),
+				Tags:        aws.StringMap(tags),
+			})
+			return err
+		},
+		untag: func(keys []string) error {
+			_, err := conn.UntagResource(&apigateway.UntagResourceInput{
+				ResourceArn: aws.String(arn),
+				TagKeys:     aws.StringSlice(keys),
+			})
+			return err
+		},
+	}
+}
+
+// apigatewayArn returns the ARN API Gateway tags are managed by for the
+// resource at the given path, e.g. /domainnames/example.com.
+func apigatewayArn(meta interface{}, path string) string {
+	client := meta.(*AWSClient)
+	return fmt.Sprintf("arn:%s:apigateway:%s::%s", client.partition, client.region, path)
+}
@@ -0,0 +1,54 @@
+package dashsoftaws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// defaultWaitMinTimeout is the smallest interval between two refreshes of a
+// waitForState poller that does not set its own. The tests shorten it, as the
+// fake AWS backend moves on with every poll rather than with time.
+var defaultWaitMinTimeout = 5 * time.Second
+
+// timeoutContext returns a context that ends after the timeout of the
+// create, update or delete being applied. Passed to the *WithContext calls
+// of a resource, it bounds the retries of the session retryer as well, which
+// would otherwise only stop after max_retries attempts.
+func timeoutContext(d *schema.ResourceData, key string) (aws.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), d.Timeout(key))
+}
+
+// remainingTimeout returns the time left until the deadline of ctx, for the
+// waits of an operation that runs several of them under one timeout.
+func remainingTimeout(ctx aws.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return deadline.Sub(time.Now())
+}
+
+// waitForState polls until the Refresh of conf returns one of its Target
+// states, and gives up with an error naming what was waited for once
+// conf.Timeout is over. A Refresh returning a nil result means the resource
+// is gone, which is what an empty Target waits for.
+func waitForState(description string, conf *resource.StateChangeConf) (interface{}, error) {
+	if conf.MinTimeout == 0 {
+		conf.MinTimeout = defaultWaitMinTimeout
+	}
+
+	out, err := conf.WaitForState()
+	if err != nil {
+		if _, ok := err.(*resource.TimeoutError); ok {
+			return out, fmt.Errorf("Timed out after %s waiting for %s: %s", conf.Timeout, description, err)
+		}
+		return out, fmt.Errorf("Error waiting for %s: %s", description, err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,679 @@
+package fakeaws
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+)
+
+// restOperation handles an operation of API Gateway, taking the wildcard
+// segments of its path and the request body, and returning the status and
+// output to encode.
+type restOperation func(s *Server, params []string, body []byte) (int, interface{}, *apiError)
+
+var apigatewayRoutes = []struct {
+	method    string
+	pattern   string
+	operation restOperation
+}{
+	{"POST", "clientcertificates", (*Server).apigatewayGenerateClientCertificate},
+	{"GET", "clientcertificates/*", (*Server).apigatewayGetClientCertificate},
+	{"PATCH", "clientcertificates/*", (*Server).apigatewayUpdateClientCertificate},
+	{"DELETE", "clientcertificates/*", (*Server).apigatewayDeleteClientCertificate},
+	{"POST", "domainnames", (*Server).apigatewayCreateDomainName},
+	{"GET", "domainnames/*", (*Server).apigatewayGetDomainName},
+	{"DELETE", "domainnames/*", (*Server).apigatewayDeleteDomainName},
+	{"POST", "domainnames/*/basepathmappings", (*Server).apigatewayCreateBasePathMapping},
+	{"GET", "domainnames/*/basepathmappings/*", (*Server).apigatewayGetBasePathMapping},
+	{"PATCH", "domainnames/*/basepathmappings/*", (*Server).apigatewayUpdateBasePathMapping},
+	{"DELETE", "domainnames/*/basepathmappings/*", (*Server).apigatewayDeleteBasePathMapping},
+	{"POST", "restapis/*/deployments", (*Server).apigatewayCreateDeployment},
+	{"GET", "restapis/*/deployments/*", (*Server).apigatewayGetDeployment},
+	{"PATCH", "restapis/*/deployments/*", (*Server).apigatewayUpdateDeployment},
+	{"DELETE", "restapis/*/deployments/*", (*Server).apigatewayDeleteDeployment},
+	{"GET", "restapis/*/stages/*", (*Server).apigatewayGetStage},
+	{"PATCH", "restapis/*/stages/*", (*Server).apigatewayUpdateStage},
+	{"DELETE", "restapis/*/stages/*", (*Server).apigatewayDeleteStage},
+}
+
+// noBasePath is the base path API Gateway reports for a mapping of the root
+// of a domain name.
+const noBasePath = "(none)"
+
+// domainName is an API Gateway custom domain name and its base path
+// mappings, by base path.
+type domainName struct {
+	domain   *apigateway.DomainName
+	mappings map[string]*apigateway.BasePathMapping
+}
+
+// restAPI is a REST API, which can only be seeded, and its deployments and
+// stages.
+type restAPI struct {
+	deployments map[string]*apigateway.Deployment
+	stages      map[string]*apigateway.Stage
+}
+
+// AddRestAPI adds a REST API with the given ID.
+func (s *Server) AddRestAPI(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restAPIs[id] = &restAPI{
+		deployments: make(map[string]*apigateway.Deployment),
+		stages:      make(map[string]*apigateway.Stage),
+	}
+}
+
+func (s *Server) serveAPIGateway(w http.ResponseWriter, r *http.Request, body []byte) {
+	segments := pathSegments(r)
+	if len(segments) == 2 && segments[0] == "tags" {
+		s.serveAPIGatewayTags(w, r, segments[1], body)
+		return
+	}
+
+	for _, route := range apigatewayRoutes {
+		params, ok := matchRoute(route.pattern, segments)
+		if !ok || route.method != r.Method {
+			continue
+		}
+
+		status, out, apiErr := route.operation(s, params, body)
+		if apiErr != nil {
+			writeRESTError(w, apiErr)
+			return
+		}
+		if out == nil {
+			w.WriteHeader(status)
+			return
+		}
+		writeJSON(w, status, out)
+		return
+	}
+
+	writeRESTError(w, newError(404, "UnknownOperationException", "Operation %s %s is not faked", r.Method, r.URL.Path))
+}
+
+// matchRoute matches the path segments against a pattern where * stands for
+// any segment, returning the segments matched by the wildcards.
+func matchRoute(pattern string, segments []string) ([]string, bool) {
+	parts := strings.Split(pattern, "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+
+	var params []string
+	for i, part := range parts {
+		switch part {
+		case "*":
+			params = append(params, segments[i])
+		case segments[i]:
+		default:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *Server) apigatewayGenerateClientCertificate(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.GenerateClientCertificateInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	id := s.nextID(6)
+	created := now()
+	expires := created.AddDate(1, 0, 0)
+	certificate := &apigateway.ClientCertificate{
+		ClientCertificateId: aws.String(id),
+		Description:         in.Description,
+		Tags:                in.Tags,
+		CreatedDate:         created,
+		ExpirationDate:      &expires,
+		PemEncodedCertificate: aws.String("-----BEGIN CERTIFICATE-----\n" +
+			base64.StdEncoding.EncodeToString([]byte("fake client certificate "+id)) +
+			"\n-----END CERTIFICATE-----\n"),
+	}
+	s.clientCertificates[id] = certificate
+	return http.StatusCreated, certificate, nil
+}
+
+func (s *Server) apigatewayGetClientCertificate(params []string, body []byte) (int, interface{}, *apiError) {
+	certificate, err := s.clientCertificate(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, certificate, nil
+}
+
+func (s *Server) apigatewayUpdateClientCertificate(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.UpdateClientCertificateInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	certificate, err := s.clientCertificate(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, op := range in.PatchOperations {
+		switch aws.StringValue(op.Path) {
+		case "/description":
+			certificate.Description = op.Value
+		default:
+			return 0, nil, invalidPatchPath(op)
+		}
+	}
+	return http.StatusOK, certificate, nil
+}
+
+func (s *Server) apigatewayDeleteClientCertificate(params []string, body []byte) (int, interface{}, *apiError) {
+	if _, err := s.clientCertificate(params[0]); err != nil {
+		return 0, nil, err
+	}
+
+	delete(s.clientCertificates, params[0])
+	return http.StatusAccepted, nil, nil
+}
+
+func (s *Server) clientCertificate(id string) (*apigateway.ClientCertificate, *apiError) {
+	certificate, ok := s.clientCertificates[id]
+	if !ok {
+		return nil, newError(404, "NotFoundException", "Invalid Client Certificate identifier specified")
+	}
+	return certificate, nil
+}
+
+func (s *Server) apigatewayCreateDomainName(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.CreateDomainNameInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	name := aws.StringValue(in.DomainName)
+	if _, ok := s.domainNames[name]; ok {
+		return 0, nil, newError(409, "ConflictException", "The domain name you provided already exists.")
+	}
+	if in.CertificateArn == nil && (in.CertificateBody == nil || in.CertificatePrivateKey == nil) {
+		return 0, nil, newError(400, "BadRequestException", "A certificate must be provided for the domain name.")
+	}
+
+	d := &domainName{
+		domain: &apigateway.DomainName{
+			DomainName:               aws.String(name),
+			CertificateName:          in.CertificateName,
+			CertificateArn:           in.CertificateArn,
+			CertificateUploadDate:    now(),
+			DistributionDomainName:   aws.String("d" + s.nextID(13) + ".cloudfront.net"),
+			DistributionHostedZoneId: aws.String("Z2FDTNDATAQYW2"),
+			DomainNameStatus:         aws.String(apigateway.DomainNameStatusAvailable),
+			Tags:                     in.Tags,
+		},
+		mappings: make(map[string]*apigateway.BasePathMapping),
+	}
+	s.domainNames[name] = d
+	return http.StatusCreated, d.domain, nil
+}
+
+func (s *Server) apigatewayGetDomainName(params []string, body []byte) (int, interface{}, *apiError) {
+	d, err := s.domainName(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, d.domain, nil
+}
+
+func (s *Server) apigatewayDeleteDomainName(params []string, body []byte) (int, interface{}, *apiError) {
+	if _, err := s.domainName(params[0]); err != nil {
+		return 0, nil, err
+	}
+
+	delete(s.domainNames, params[0])
+	return http.StatusAccepted, nil, nil
+}
+
+func (s *Server) domainName(name string) (*domainName, *apiError) {
+	d, ok := s.domainNames[name]
+	if !ok {
+		return nil, newError(404, "NotFoundException", "Invalid domain name identifier specified")
+	}
+	return d, nil
+}
+
+func (s *Server) apigatewayCreateBasePathMapping(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.CreateBasePathMappingInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	d, err := s.domainName(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	basePath := aws.StringValue(in.BasePath)
+	if basePath == "" {
+		basePath = noBasePath
+	}
+	if _, ok := d.mappings[basePath]; ok {
+		return 0, nil, newError(409, "ConflictException", "Base path already exists for this domain name")
+	}
+
+	mapping := &apigateway.BasePathMapping{
+		BasePath:  aws.String(basePath),
+		RestApiId: in.RestApiId,
+		Stage:     in.Stage,
+	}
+	if err := s.checkMapping(mapping); err != nil {
+		return 0, nil, err
+	}
+
+	d.mappings[basePath] = mapping
+	return http.StatusCreated, mapping, nil
+}
+
+func (s *Server) apigatewayGetBasePathMapping(params []string, body []byte) (int, interface{}, *apiError) {
+	_, mapping, err := s.basePathMapping(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, mapping, nil
+}
+
+func (s *Server) apigatewayUpdateBasePathMapping(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.UpdateBasePathMappingInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	d, mapping, err := s.basePathMapping(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	updated := *mapping
+	for _, op := range in.PatchOperations {
+		switch aws.StringValue(op.Path) {
+		case "/basePath":
+			updated.BasePath = op.Value
+			if aws.StringValue(op.Value) == "" {
+				updated.BasePath = aws.String(noBasePath)
+			}
+		case "/restapiId":
+			updated.RestApiId = op.Value
+		case "/stage":
+			updated.Stage = op.Value
+		default:
+			return 0, nil, invalidPatchPath(op)
+		}
+	}
+	if err := s.checkMapping(&updated); err != nil {
+		return 0, nil, err
+	}
+
+	delete(d.mappings, aws.StringValue(mapping.BasePath))
+	d.mappings[aws.StringValue(updated.BasePath)] = &updated
+	return http.StatusOK, &updated, nil
+}
+
+func (s *Server) apigatewayDeleteBasePathMapping(params []string, body []byte) (int, interface{}, *apiError) {
+	d, mapping, err := s.basePathMapping(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	delete(d.mappings, aws.StringValue(mapping.BasePath))
+	return http.StatusAccepted, nil, nil
+}
+
+func (s *Server) basePathMapping(name, basePath string) (*domainName, *apigateway.BasePathMapping, *apiError) {
+	d, err := s.domainName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if basePath == "" {
+		basePath = noBasePath
+	}
+	mapping, ok := d.mappings[basePath]
+	if !ok {
+		return nil, nil, newError(404, "NotFoundException", "Invalid base path mapping identifier specified")
+	}
+	return d, mapping, nil
+}
+
+// checkMapping checks that the REST API and stage of a base path mapping
+// exist.
+func (s *Server) checkMapping(mapping *apigateway.BasePathMapping) *apiError {
+	api, ok := s.restAPIs[aws.StringValue(mapping.RestApiId)]
+	if !ok {
+		return newError(400, "BadRequestException", "Invalid REST API identifier specified")
+	}
+	if stage := aws.StringValue(mapping.Stage); stage != "" {
+		if _, ok := api.stages[stage]; !ok {
+			return newError(400, "BadRequestException", "Invalid stage identifier specified")
+		}
+	}
+	return nil
+}
+
+func (s *Server) apigatewayCreateDeployment(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.CreateDeploymentInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	api, err := s.restAPI(params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	deployment := &apigateway.Deployment{
+		Id:          aws.String(s.nextID(6)),
+		Description: in.Description,
+		CreatedDate: now(),
+	}
+	api.deployments[aws.StringValue(deployment.Id)] = deployment
+
+	// A deployment to a stage creates the stage, or points it at the new
+	// deployment
+	if name := aws.StringValue(in.StageName); name != "" {
+		stage, ok := api.stages[name]
+		if !ok {
+			stage = &apigateway.Stage{
+				StageName:      aws.String(name),
+				CreatedDate:    now(),
+				MethodSettings: make(map[string]*apigateway.MethodSetting),
+			}
+			api.stages[name] = stage
+		}
+		stage.DeploymentId = deployment.Id
+		stage.LastUpdatedDate = now()
+		if in.StageDescription != nil {
+			stage.Description = in.StageDescription
+		}
+		if in.CacheClusterEnabled != nil {
+			stage.CacheClusterEnabled = in.CacheClusterEnabled
+		}
+		if in.CacheClusterSize != nil {
+			stage.CacheClusterSize = in.CacheClusterSize
+		}
+		if in.Variables != nil {
+			stage.Variables = in.Variables
+		}
+	}
+
+	return http.StatusCreated, deployment, nil
+}
+
+func (s *Server) apigatewayGetDeployment(params []string, body []byte) (int, interface{}, *apiError) {
+	_, deployment, err := s.deployment(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, deployment, nil
+}
+
+func (s *Server) apigatewayUpdateDeployment(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.UpdateDeploymentInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	_, deployment, err := s.deployment(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, op := range in.PatchOperations {
+		switch aws.StringValue(op.Path) {
+		case "/description":
+			deployment.Description = op.Value
+		default:
+			return 0, nil, invalidPatchPath(op)
+		}
+	}
+	return http.StatusOK, deployment, nil
+}
+
+func (s *Server) apigatewayDeleteDeployment(params []string, body []byte) (int, interface{}, *apiError) {
+	api, deployment, err := s.deployment(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, stage := range api.stages {
+		if aws.StringValue(stage.DeploymentId) == aws.StringValue(deployment.Id) {
+			return 0, nil, newError(400, "BadRequestException",
+				"Active stages pointing to this deployment must be moved or deleted")
+		}
+	}
+
+	delete(api.deployments, params[1])
+	return http.StatusAccepted, nil, nil
+}
+
+func (s *Server) restAPI(id string) (*restAPI, *apiError) {
+	api, ok := s.restAPIs[id]
+	if !ok {
+		return nil, newError(404, "NotFoundException", "Invalid REST API identifier specified")
+	}
+	return api, nil
+}
+
+func (s *Server) deployment(restAPIID, id string) (*restAPI, *apigateway.Deployment, *apiError) {
+	api, err := s.restAPI(restAPIID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deployment, ok := api.deployments[id]
+	if !ok {
+		return nil, nil, newError(404, "NotFoundException", "Invalid Deployment identifier specified")
+	}
+	return api, deployment, nil
+}
+
+func (s *Server) apigatewayGetStage(params []string, body []byte) (int, interface{}, *apiError) {
+	_, stage, err := s.stage(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, stage, nil
+}
+
+func (s *Server) apigatewayUpdateStage(params []string, body []byte) (int, interface{}, *apiError) {
+	var in apigateway.UpdateStageInput
+	if err := decodeJSON(body, &in); err != nil {
+		return 0, nil, err
+	}
+
+	_, stage, err := s.stage(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, op := range in.PatchOperations {
+		if err := patchStage(stage, op); err != nil {
+			return 0, nil, err
+		}
+	}
+	stage.LastUpdatedDate = now()
+	return http.StatusOK, stage, nil
+}
+
+func (s *Server) apigatewayDeleteStage(params []string, body []byte) (int, interface{}, *apiError) {
+	api, _, err := s.stage(params[0], params[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	delete(api.stages, params[1])
+	return http.StatusAccepted, nil, nil
+}
+
+func (s *Server) stage(restAPIID, name string) (*restAPI, *apigateway.Stage, *apiError) {
+	api, err := s.restAPI(restAPIID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stage, ok := api.stages[name]
+	if !ok {
+		return nil, nil, newError(404, "NotFoundException", "Invalid Stage identifier specified")
+	}
+	return api, stage, nil
+}
+
+// patchStage applies a patch operation to the stage settings, and to the
+// method settings of all methods (the */* paths).
+func patchStage(stage *apigateway.Stage, op *apigateway.PatchOperation) *apiError {
+	path := aws.StringValue(op.Path)
+	value := aws.StringValue(op.Value)
+
+	if strings.HasPrefix(path, "/variables/") {
+		name := strings.TrimPrefix(path, "/variables/")
+		if stage.Variables == nil {
+			stage.Variables = make(map[string]*string)
+		}
+		if aws.StringValue(op.Op) == apigateway.OpRemove {
+			delete(stage.Variables, name)
+		} else {
+			stage.Variables[name] = op.Value
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(path, "/*/*/") {
+		setting, ok := stage.MethodSettings["*/*"]
+		if !ok {
+			setting = &apigateway.MethodSetting{}
+			stage.MethodSettings["*/*"] = setting
+		}
+
+		var err error
+		switch strings.TrimPrefix(path, "/*/*/") {
+		case "logging/loglevel":
+			setting.LoggingLevel = op.Value
+		case "logging/dataTrace":
+			var enabled bool
+			enabled, err = strconv.ParseBool(value)
+			setting.DataTraceEnabled = aws.Bool(enabled)
+		case "metrics/enabled":
+			var enabled bool
+			enabled, err = strconv.ParseBool(value)
+			setting.MetricsEnabled = aws.Bool(enabled)
+		case "throttling/burstLimit":
+			var limit int64
+			limit, err = strconv.ParseInt(value, 10, 64)
+			setting.ThrottlingBurstLimit = aws.Int64(limit)
+		case "throttling/rateLimit":
+			var limit float64
+			limit, err = strconv.ParseFloat(value, 64)
+			setting.ThrottlingRateLimit = aws.Float64(limit)
+		default:
+			return invalidPatchPath(op)
+		}
+		if err != nil {
+			return newError(400, "BadRequestException", "Invalid value %q for %s", value, path)
+		}
+		return nil
+	}
+
+	switch path {
+	case "/description":
+		stage.Description = op.Value
+	case "/deploymentId":
+		stage.DeploymentId = op.Value
+	case "/clientCertificateId":
+		stage.ClientCertificateId = op.Value
+	case "/cacheClusterSize":
+		stage.CacheClusterSize = op.Value
+	case "/cacheClusterEnabled":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return newError(400, "BadRequestException", "Invalid value %q for %s", value, path)
+		}
+		stage.CacheClusterEnabled = aws.Bool(enabled)
+	default:
+		return invalidPatchPath(op)
+	}
+	return nil
+}
+
+// serveAPIGatewayTags serves the tag operations under /tags/{resource_arn},
+// for domain names, client certificates and stages.
+func (s *Server) serveAPIGatewayTags(w http.ResponseWriter, r *http.Request, resourceArn string, body []byte) {
+	tags, apiErr := s.apigatewayTags(resourceArn)
+	if apiErr != nil {
+		writeRESTError(w, apiErr)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, &apigateway.GetTagsOutput{Tags: *tags})
+	case "PUT":
+		var in apigateway.TagResourceInput
+		if err := decodeJSON(body, &in); err != nil {
+			writeRESTError(w, err)
+			return
+		}
+		if *tags == nil {
+			*tags = make(map[string]*string)
+		}
+		for key, value := range in.Tags {
+			(*tags)[key] = value
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		for _, key := range r.URL.Query()["tagKeys"] {
+			delete(*tags, key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeRESTError(w, newError(404, "UnknownOperationException", "Operation %s %s is not faked", r.Method, r.URL.Path))
+	}
+}
+
+// apigatewayTags returns the tags of the resource with the given ARN, of the
+// form arn:aws:apigateway:{region}::{path}.
+func (s *Server) apigatewayTags(resourceArn string) (*map[string]*string, *apiError) {
+	parts := strings.SplitN(resourceArn, "::", 2)
+	if len(parts) != 2 {
+		return nil, newError(400, "BadRequestException", "Invalid ARN specified in the request")
+	}
+
+	segments := strings.Split(strings.Trim(parts[1], "/"), "/")
+	if params, ok := matchRoute("domainnames/*", segments); ok {
+		d, err := s.domainName(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return &d.domain.Tags, nil
+	}
+	if params, ok := matchRoute("clientcertificates/*", segments); ok {
+		certificate, err := s.clientCertificate(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return &certificate.Tags, nil
+	}
+	if params, ok := matchRoute("restapis/*/stages/*", segments); ok {
+		_, stage, err := s.stage(params[0], params[1])
+		if err != nil {
+			return nil, err
+		}
+		return &stage.Tags, nil
+	}
+	return nil, newError(400, "BadRequestException", "Invalid ARN specified in the request")
+}
+
+func invalidPatchPath(op *apigateway.PatchOperation) *apiError {
+	return newError(400, "BadRequestException", "Invalid patch path %s", aws.StringValue(op.Path))
+}
@@ -0,0 +1,350 @@
+package fakeaws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var dynamodbOperations = map[string]jsonOperation{
+	"CreateTable":        (*Server).dynamodbCreateTable,
+	"DeleteTable":        (*Server).dynamodbDeleteTable,
+	"DescribeTable":      (*Server).dynamodbDescribeTable,
+	"ListTagsOfResource": (*Server).dynamodbListTagsOfResource,
+	"TagResource":        (*Server).dynamodbTagResource,
+	"UntagResource":      (*Server).dynamodbUntagResource,
+	"UpdateTable":        (*Server).dynamodbUpdateTable,
+}
+
+// table is a DynamoDB table. A table is CREATING or UPDATING for one observation
+// after a change, and so are the global secondary indexes being created or
+// updated; deleted tables and indexes are DELETING once before they are gone.
+type table struct {
+	description *dynamodb.TableDescription
+	status      *status
+	indexes     map[string]*status
+	tags        map[string]string
+}
+
+func (s *Server) dynamodbCreateTable(body []byte) (interface{}, *apiError) {
+	var in dynamodb.CreateTableInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.TableName)
+	if _, ok := s.tables[name]; ok {
+		return nil, newError(400, "ResourceInUseException", "Table already exists: %s", name)
+	}
+
+	t := &table{
+		description: &dynamodb.TableDescription{
+			TableName:            in.TableName,
+			TableArn:             aws.String(arn("dynamodb", "table/"+name)),
+			TableId:              aws.String(s.nextID(36)),
+			AttributeDefinitions: in.AttributeDefinitions,
+			KeySchema:            in.KeySchema,
+			CreationDateTime:     now(),
+			ItemCount:            aws.Int64(0),
+			TableSizeBytes:       aws.Int64(0),
+			ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:      in.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits:     in.ProvisionedThroughput.WriteCapacityUnits,
+				NumberOfDecreasesToday: aws.Int64(0),
+			},
+		},
+		status:  newStatus(dynamodb.TableStatusCreating, dynamodb.TableStatusActive),
+		indexes: make(map[string]*status),
+		tags:    make(map[string]string),
+	}
+	for _, tag := range in.Tags {
+		t.tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	for _, lsi := range in.LocalSecondaryIndexes {
+		t.description.LocalSecondaryIndexes = append(t.description.LocalSecondaryIndexes, &dynamodb.LocalSecondaryIndexDescription{
+			IndexName:  lsi.IndexName,
+			IndexArn:   aws.String(arn("dynamodb", "table/"+name+"/index/"+aws.StringValue(lsi.IndexName))),
+			KeySchema:  lsi.KeySchema,
+			Projection: lsi.Projection,
+		})
+	}
+
+	for _, gsi := range in.GlobalSecondaryIndexes {
+		t.addIndex(gsi.IndexName, gsi.KeySchema, gsi.Projection, gsi.ProvisionedThroughput)
+	}
+
+	if in.StreamSpecification != nil && aws.BoolValue(in.StreamSpecification.StreamEnabled) {
+		t.enableStream(in.StreamSpecification)
+	}
+
+	s.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: t.describe(false)}, nil
+}
+
+func (s *Server) dynamodbDescribeTable(body []byte) (interface{}, *apiError) {
+	var in dynamodb.DescribeTableInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	t, err := s.table(aws.StringValue(in.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	description := t.describe(true)
+	if description == nil {
+		delete(s.tables, aws.StringValue(in.TableName))
+		return nil, tableNotFound(aws.StringValue(in.TableName))
+	}
+	return &dynamodb.DescribeTableOutput{Table: description}, nil
+}
+
+func (s *Server) dynamodbUpdateTable(body []byte) (interface{}, *apiError) {
+	var in dynamodb.UpdateTableInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.TableName)
+	t, err := s.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkActive(); err != nil {
+		return nil, err
+	}
+
+	if in.ProvisionedThroughput != nil {
+		t.description.ProvisionedThroughput.ReadCapacityUnits = in.ProvisionedThroughput.ReadCapacityUnits
+		t.description.ProvisionedThroughput.WriteCapacityUnits = in.ProvisionedThroughput.WriteCapacityUnits
+	}
+
+	if in.StreamSpecification != nil {
+		if aws.BoolValue(in.StreamSpecification.StreamEnabled) {
+			t.enableStream(in.StreamSpecification)
+		} else {
+			t.description.StreamSpecification = nil
+		}
+	}
+
+	for _, update := range in.GlobalSecondaryIndexUpdates {
+		switch {
+		case update.Create != nil:
+			indexName := aws.StringValue(update.Create.IndexName)
+			if _, ok := t.indexes[indexName]; ok {
+				return nil, newError(400, "ValidationException", "Index %s already exists on table %s", indexName, name)
+			}
+			t.addIndex(update.Create.IndexName, update.Create.KeySchema, update.Create.Projection, update.Create.ProvisionedThroughput)
+
+		case update.Update != nil:
+			index, err := t.index(aws.StringValue(update.Update.IndexName))
+			if err != nil {
+				return nil, err
+			}
+			index.ProvisionedThroughput.ReadCapacityUnits = update.Update.ProvisionedThroughput.ReadCapacityUnits
+			index.ProvisionedThroughput.WriteCapacityUnits = update.Update.ProvisionedThroughput.WriteCapacityUnits
+			t.indexes[aws.StringValue(index.IndexName)].set(dynamodb.IndexStatusUpdating, dynamodb.IndexStatusActive)
+
+		case update.Delete != nil:
+			index, err := t.index(aws.StringValue(update.Delete.IndexName))
+			if err != nil {
+				return nil, err
+			}
+			t.indexes[aws.StringValue(index.IndexName)].set(dynamodb.IndexStatusDeleting, "")
+		}
+	}
+
+	for _, definition := range in.AttributeDefinitions {
+		if !t.hasAttribute(aws.StringValue(definition.AttributeName)) {
+			t.description.AttributeDefinitions = append(t.description.AttributeDefinitions, definition)
+		}
+	}
+
+	t.status.set(dynamodb.TableStatusUpdating, dynamodb.TableStatusActive)
+	return &dynamodb.UpdateTableOutput{TableDescription: t.describe(false)}, nil
+}
+
+func (s *Server) dynamodbDeleteTable(body []byte) (interface{}, *apiError) {
+	var in dynamodb.DeleteTableInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	t, err := s.table(aws.StringValue(in.TableName))
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkActive(); err != nil {
+		return nil, err
+	}
+
+	t.status.set(dynamodb.TableStatusDeleting, "")
+	return &dynamodb.DeleteTableOutput{TableDescription: t.describe(false)}, nil
+}
+
+func (s *Server) dynamodbListTagsOfResource(body []byte) (interface{}, *apiError) {
+	var in dynamodb.ListTagsOfResourceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	t, err := s.table(lastSegment(aws.StringValue(in.ResourceArn), "table/"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(t.tags))
+	for key := range t.tags {
+		keys = append(keys, key)
+	}
+	keys, next, err := page(keys, aws.StringValue(in.NextToken), 10)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.ListTagsOfResourceOutput{Tags: []*dynamodb.Tag{}}
+	for _, key := range keys {
+		out.Tags = append(out.Tags, &dynamodb.Tag{Key: aws.String(key), Value: aws.String(t.tags[key])})
+	}
+	if next != "" {
+		out.NextToken = aws.String(next)
+	}
+	return out, nil
+}
+
+func (s *Server) dynamodbTagResource(body []byte) (interface{}, *apiError) {
+	var in dynamodb.TagResourceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	t, err := s.table(lastSegment(aws.StringValue(in.ResourceArn), "table/"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range in.Tags {
+		t.tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return &dynamodb.TagResourceOutput{}, nil
+}
+
+func (s *Server) dynamodbUntagResource(body []byte) (interface{}, *apiError) {
+	var in dynamodb.UntagResourceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	t, err := s.table(lastSegment(aws.StringValue(in.ResourceArn), "table/"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range aws.StringValueSlice(in.TagKeys) {
+		delete(t.tags, key)
+	}
+	return &dynamodb.UntagResourceOutput{}, nil
+}
+
+func (s *Server) table(name string) (*table, *apiError) {
+	t, ok := s.tables[name]
+	if !ok || t.status.peek() == "" {
+		return nil, tableNotFound(name)
+	}
+	return t, nil
+}
+
+func tableNotFound(name string) *apiError {
+	return newError(400, "ResourceNotFoundException", "Requested resource not found: Table: %s not found", name)
+}
+
+// checkActive returns the error DynamoDB answers changes to a table or index
+// that is still changing with.
+func (t *table) checkActive() *apiError {
+	if t.status.peek() != dynamodb.TableStatusActive {
+		return newError(400, "ResourceInUseException", "Attempt to change a resource which is still in use: Table is being %s",
+			t.status.peek())
+	}
+	for name, index := range t.indexes {
+		if index.peek() != dynamodb.IndexStatusActive {
+			return newError(400, "ResourceInUseException", "Attempt to change a resource which is still in use: Index %s is %s",
+				name, index.peek())
+		}
+	}
+	return nil
+}
+
+func (t *table) addIndex(name *string, keySchema []*dynamodb.KeySchemaElement, projection *dynamodb.Projection, throughput *dynamodb.ProvisionedThroughput) {
+	tableName := aws.StringValue(t.description.TableName)
+	t.description.GlobalSecondaryIndexes = append(t.description.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndexDescription{
+		IndexName:      name,
+		IndexArn:       aws.String(arn("dynamodb", "table/"+tableName+"/index/"+aws.StringValue(name))),
+		KeySchema:      keySchema,
+		Projection:     projection,
+		IndexSizeBytes: aws.Int64(0),
+		ItemCount:      aws.Int64(0),
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{
+			ReadCapacityUnits:      throughput.ReadCapacityUnits,
+			WriteCapacityUnits:     throughput.WriteCapacityUnits,
+			NumberOfDecreasesToday: aws.Int64(0),
+		},
+	})
+	t.indexes[aws.StringValue(name)] = newStatus(dynamodb.IndexStatusCreating, dynamodb.IndexStatusActive)
+}
+
+func (t *table) index(name string) (*dynamodb.GlobalSecondaryIndexDescription, *apiError) {
+	for _, index := range t.description.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == name && t.indexes[name].peek() != "" {
+			return index, nil
+		}
+	}
+	return nil, newError(400, "ResourceNotFoundException", "Requested resource not found: Index: %s not found", name)
+}
+
+func (t *table) hasAttribute(name string) bool {
+	for _, definition := range t.description.AttributeDefinitions {
+		if aws.StringValue(definition.AttributeName) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *table) enableStream(spec *dynamodb.StreamSpecification) {
+	label := now().Format("2006-01-02T15:04:05.000")
+	t.description.StreamSpecification = spec
+	t.description.LatestStreamLabel = aws.String(label)
+	t.description.LatestStreamArn = aws.String(aws.StringValue(t.description.TableArn) + "/stream/" + label)
+}
+
+// describe returns the description of the table with the current status of
+// the table and its indexes, moving them on when observe is set. It returns
+// nil for a table that is gone.
+func (t *table) describe(observe bool) *dynamodb.TableDescription {
+	state := (*status).peek
+	if observe {
+		state = (*status).observe
+	}
+
+	tableStatus := state(t.status)
+	if tableStatus == "" {
+		return nil
+	}
+	t.description.TableStatus = aws.String(tableStatus)
+
+	indexes := t.description.GlobalSecondaryIndexes[:0]
+	for _, index := range t.description.GlobalSecondaryIndexes {
+		name := aws.StringValue(index.IndexName)
+		indexStatus := state(t.indexes[name])
+		if indexStatus == "" {
+			delete(t.indexes, name)
+			continue
+		}
+		index.IndexStatus = aws.String(indexStatus)
+		indexes = append(indexes, index)
+	}
+	t.description.GlobalSecondaryIndexes = indexes
+
+	return t.description
+}
@@ -0,0 +1,909 @@
+package fakeaws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+var ecsOperations = map[string]jsonOperation{
+	"CreateCluster":                 (*Server).ecsCreateCluster,
+	"DeleteCluster":                 (*Server).ecsDeleteCluster,
+	"DeleteService":                 (*Server).ecsDeleteService,
+	"DeregisterContainerInstance":   (*Server).ecsDeregisterContainerInstance,
+	"DescribeClusters":              (*Server).ecsDescribeClusters,
+	"DescribeContainerInstances":    (*Server).ecsDescribeContainerInstances,
+	"DescribeServices":              (*Server).ecsDescribeServices,
+	"DescribeTasks":                 (*Server).ecsDescribeTasks,
+	"ListContainerInstances":        (*Server).ecsListContainerInstances,
+	"ListServices":                  (*Server).ecsListServices,
+	"ListTagsForResource":           (*Server).ecsListTagsForResource,
+	"ListTasks":                     (*Server).ecsListTasks,
+	"PutClusterCapacityProviders":   (*Server).ecsPutClusterCapacityProviders,
+	"StopTask":                      (*Server).ecsStopTask,
+	"TagResource":                   (*Server).ecsTagResource,
+	"UntagResource":                 (*Server).ecsUntagResource,
+	"UpdateClusterSettings":         (*Server).ecsUpdateClusterSettings,
+	"UpdateContainerInstancesState": (*Server).ecsUpdateContainerInstancesState,
+	"UpdateService":                 (*Server).ecsUpdateService,
+}
+
+// cluster is an ECS cluster. A deleted cluster is DEPROVISIONING once before
+// it is INACTIVE, and stays around as INACTIVE like on AWS. Capacity providers
+// put on the cluster are UPDATE_IN_PROGRESS once before they are attached.
+type cluster struct {
+	cluster     *ecs.Cluster
+	status      *status
+	attachments *status
+	services    map[string]*service
+	instances   map[string]*containerInstance
+	tasks       map[string]*task
+
+	// cleanupCalls is the number of DeleteCluster calls still to fail after
+	// the cluster has been emptied
+	cleanupCalls int
+}
+
+// service is an ECS service and the tasks ECS started for it. Its running
+// count catches up with its desired count the next time it is observed, which
+// stops the tasks beyond the desired count, and a deleted service is DRAINING
+// once before it is INACTIVE.
+type service struct {
+	service *ecs.Service
+	status  *status
+	tasks   []*task
+}
+
+// containerInstance is an ECS container instance and the number of service
+// tasks running on it. Once it is DRAINING, its service tasks are gone after
+// it has been observed once more.
+type containerInstance struct {
+	instance     *ecs.ContainerInstance
+	serviceTasks int64
+}
+
+// task is an ECS task, started by the service it is named after or outside
+// of any service when service is empty. A stopped task is STOPPING once
+// before it is STOPPED, and stays around as STOPPED.
+type task struct {
+	task    *ecs.Task
+	status  *status
+	service string
+}
+
+// AddECSTask starts a standalone task, like RunTask, in a cluster created
+// through the provider, and returns its ARN. The task runs on the given
+// container instance, which keeps the instance from draining until the task
+// is stopped, or on Fargate when containerInstanceArn is empty.
+func (s *Server) AddECSTask(clusterName, containerInstanceArn string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cluster(clusterName)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err.code, err.message)
+	}
+
+	launchType, instanceArn := ecs.LaunchTypeFargate, (*string)(nil)
+	if containerInstanceArn != "" {
+		if _, ok := c.instances[lastSegment(containerInstanceArn, "/")]; !ok {
+			return "", fmt.Errorf("container instance %s is not registered to cluster %s", containerInstanceArn, clusterName)
+		}
+		launchType, instanceArn = ecs.LaunchTypeEc2, aws.String(containerInstanceArn)
+	}
+
+	id := s.nextID(32)
+	c.tasks[id] = &task{
+		task: &ecs.Task{
+			TaskArn:              aws.String(arn("ecs", "task/"+aws.StringValue(c.cluster.ClusterName)+"/"+id)),
+			ClusterArn:           c.cluster.ClusterArn,
+			ContainerInstanceArn: instanceArn,
+			LastStatus:           aws.String("RUNNING"),
+			DesiredStatus:        aws.String(ecs.DesiredStatusRunning),
+			Group:                aws.String("family:job"),
+			LaunchType:           aws.String(launchType),
+			CreatedAt:            now(),
+		},
+		status: newStatus("RUNNING"),
+	}
+	return aws.StringValue(c.tasks[id].task.TaskArn), nil
+}
+
+// DelayECSClusterDeletion makes the next given number of DeleteCluster calls
+// to a cluster created through the provider fail with
+// ClusterContainsTasksException, as they do on AWS for a while after its last
+// tasks have stopped.
+func (s *Server) DelayECSClusterDeletion(clusterName string, calls int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cluster(clusterName)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err.code, err.message)
+	}
+
+	c.cleanupCalls = calls
+	return nil
+}
+
+// AddECSContainerInstance registers a container instance running the given
+// number of service tasks to a cluster created through the provider, and
+// returns its ARN.
+func (s *Server) AddECSContainerInstance(clusterName string, serviceTasks int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cluster(clusterName)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err.code, err.message)
+	}
+
+	id := s.nextID(32)
+	ci := &containerInstance{
+		instance: &ecs.ContainerInstance{
+			ContainerInstanceArn: aws.String(arn("ecs", "container-instance/"+aws.StringValue(c.cluster.ClusterName)+"/"+id)),
+			Ec2InstanceId:        aws.String("i-" + s.nextID(17)),
+			Status:               aws.String(ecs.ContainerInstanceStatusActive),
+			AgentConnected:       aws.Bool(true),
+			PendingTasksCount:    aws.Int64(0),
+			RunningTasksCount:    aws.Int64(serviceTasks),
+			RegisteredAt:         now(),
+		},
+		serviceTasks: serviceTasks,
+	}
+	c.instances[id] = ci
+	return aws.StringValue(ci.instance.ContainerInstanceArn), nil
+}
+
+// AddECSService adds a service with the given desired count to a cluster
+// created through the provider, and starts its tasks. Like on AWS, the
+// startedBy of the tasks is ecs-svc/ followed by the ID of the deployment;
+// they are not placed on the container instances, whose service tasks are
+// counted by AddECSContainerInstance.
+func (s *Server) AddECSService(clusterName, serviceName string, desiredCount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cluster(clusterName)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err.code, err.message)
+	}
+
+	svc := &service{
+		service: &ecs.Service{
+			ServiceName:  aws.String(serviceName),
+			ServiceArn:   aws.String(arn("ecs", "service/"+serviceName)),
+			ClusterArn:   c.cluster.ClusterArn,
+			Status:       aws.String("ACTIVE"),
+			DesiredCount: aws.Int64(desiredCount),
+			RunningCount: aws.Int64(desiredCount),
+			PendingCount: aws.Int64(0),
+			LaunchType:   aws.String(ecs.LaunchTypeEc2),
+			CreatedAt:    now(),
+		},
+		status: newStatus("ACTIVE"),
+	}
+	deploymentID := s.nextID(19)
+	for i := int64(0); i < desiredCount; i++ {
+		id := s.nextID(32)
+		t := &task{
+			task: &ecs.Task{
+				TaskArn:       aws.String(arn("ecs", "task/"+clusterName+"/"+id)),
+				ClusterArn:    c.cluster.ClusterArn,
+				LastStatus:    aws.String("RUNNING"),
+				DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+				Group:         aws.String("service:" + serviceName),
+				StartedBy:     aws.String("ecs-svc/" + deploymentID),
+				LaunchType:    svc.service.LaunchType,
+				CreatedAt:     now(),
+			},
+			status:  newStatus("RUNNING"),
+			service: serviceName,
+		}
+		c.tasks[id] = t
+		svc.tasks = append(svc.tasks, t)
+	}
+	c.services[serviceName] = svc
+	return nil
+}
+
+func (s *Server) ecsCreateCluster(body []byte) (interface{}, *apiError) {
+	var in ecs.CreateClusterInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.ClusterName)
+	if name == "" {
+		name = "default"
+	}
+
+	// CreateCluster is idempotent, and brings back INACTIVE clusters
+	if c, ok := s.clusters[name]; ok && c.status.peek() != "INACTIVE" {
+		return &ecs.CreateClusterOutput{Cluster: c.describe(false, ecs.ClusterFieldTags, ecs.ClusterFieldSettings)}, nil
+	}
+
+	for _, item := range in.DefaultCapacityProviderStrategy {
+		if !containsString(aws.StringValueSlice(in.CapacityProviders), aws.StringValue(item.CapacityProvider)) {
+			return nil, newError(400, "InvalidParameterException",
+				"The specified capacity provider strategy cannot contain a capacity provider that is not associated with the cluster.")
+		}
+	}
+
+	c := &cluster{
+		cluster: &ecs.Cluster{
+			ClusterName:                     aws.String(name),
+			ClusterArn:                      aws.String(arn("ecs", "cluster/"+name)),
+			Tags:                            in.Tags,
+			CapacityProviders:               in.CapacityProviders,
+			DefaultCapacityProviderStrategy: in.DefaultCapacityProviderStrategy,
+			Settings: []*ecs.ClusterSetting{{
+				Name:  aws.String(ecs.ClusterSettingNameContainerInsights),
+				Value: aws.String("disabled"),
+			}},
+		},
+		status:    newStatus("ACTIVE"),
+		services:  make(map[string]*service),
+		instances: make(map[string]*containerInstance),
+		tasks:     make(map[string]*task),
+	}
+	c.updateSettings(in.Settings)
+	s.clusters[name] = c
+	return &ecs.CreateClusterOutput{Cluster: c.describe(false, ecs.ClusterFieldTags, ecs.ClusterFieldSettings)}, nil
+}
+
+func (s *Server) ecsDescribeClusters(body []byte) (interface{}, *apiError) {
+	var in ecs.DescribeClustersInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	names := aws.StringValueSlice(in.Clusters)
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+
+	out := &ecs.DescribeClustersOutput{
+		Clusters: []*ecs.Cluster{},
+		Failures: []*ecs.Failure{},
+	}
+	for _, name := range names {
+		c, ok := s.clusters[lastSegment(name, "cluster/")]
+		if !ok {
+			out.Failures = append(out.Failures, &ecs.Failure{
+				Arn:    aws.String(arn("ecs", "cluster/"+lastSegment(name, "cluster/"))),
+				Reason: aws.String("MISSING"),
+			})
+			continue
+		}
+		out.Clusters = append(out.Clusters, c.describe(true, aws.StringValueSlice(in.Include)...))
+	}
+	return out, nil
+}
+
+func (s *Server) ecsDeleteCluster(body []byte) (interface{}, *apiError) {
+	var in ecs.DeleteClusterInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted services are only gone once they have drained, which the
+	// retries of DeleteCluster get to observe
+	active := false
+	for _, svc := range c.services {
+		if aws.StringValue(svc.observe().Status) != "INACTIVE" {
+			active = true
+		}
+	}
+	if active {
+		return nil, newError(400, "ClusterContainsServicesException",
+			"The Cluster cannot be deleted while Services are active.")
+	}
+	for _, t := range c.tasks {
+		if t.status.peek() != "STOPPED" {
+			return nil, newError(400, "ClusterContainsTasksException",
+				"The Cluster cannot be deleted while Tasks are active.")
+		}
+	}
+	if len(c.instances) > 0 {
+		return nil, newError(400, "ClusterContainsContainerInstancesException",
+			"The Cluster cannot be deleted while Container Instances are active or draining.")
+	}
+	if c.cleanupCalls > 0 {
+		c.cleanupCalls--
+		return nil, newError(400, "ClusterContainsTasksException",
+			"The Cluster cannot be deleted while Tasks are active.")
+	}
+
+	c.status.set("DEPROVISIONING", "INACTIVE")
+	return &ecs.DeleteClusterOutput{Cluster: c.describe(false, ecs.ClusterFieldTags, ecs.ClusterFieldSettings)}, nil
+}
+
+func (s *Server) ecsUpdateClusterSettings(body []byte) (interface{}, *apiError) {
+	var in ecs.UpdateClusterSettingsInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, setting := range in.Settings {
+		if aws.StringValue(setting.Name) != ecs.ClusterSettingNameContainerInsights {
+			return nil, newError(400, "InvalidParameterException", "Unknown cluster setting %s.", aws.StringValue(setting.Name))
+		}
+	}
+
+	c.updateSettings(in.Settings)
+	return &ecs.UpdateClusterSettingsOutput{Cluster: c.describe(false, ecs.ClusterFieldSettings)}, nil
+}
+
+func (s *Server) ecsPutClusterCapacityProviders(body []byte) (interface{}, *apiError) {
+	var in ecs.PutClusterCapacityProvidersInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	if in.CapacityProviders == nil || in.DefaultCapacityProviderStrategy == nil {
+		return nil, newError(400, "InvalidParameterException",
+			"capacityProviders and defaultCapacityProviderStrategy are required.")
+	}
+	for _, item := range in.DefaultCapacityProviderStrategy {
+		if !containsString(aws.StringValueSlice(in.CapacityProviders), aws.StringValue(item.CapacityProvider)) {
+			return nil, newError(400, "InvalidParameterException",
+				"The specified capacity provider strategy cannot contain a capacity provider that is not associated with the cluster.")
+		}
+	}
+	if c.attachments != nil && c.attachments.peek() == "UPDATE_IN_PROGRESS" {
+		return nil, newError(400, "UpdateInProgressException",
+			"The specified cluster is in a busy state. Cluster attachments must be in UPDATE_COMPLETE or UPDATE_FAILED state before they can be updated.")
+	}
+
+	c.cluster.CapacityProviders = in.CapacityProviders
+	c.cluster.DefaultCapacityProviderStrategy = in.DefaultCapacityProviderStrategy
+	c.attachments = newStatus("UPDATE_IN_PROGRESS", "UPDATE_COMPLETE")
+	return &ecs.PutClusterCapacityProvidersOutput{Cluster: c.describe(false)}, nil
+}
+
+func (s *Server) ecsListTagsForResource(body []byte) (interface{}, *apiError) {
+	var in ecs.ListTagsForResourceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.ResourceArn))
+	if err != nil {
+		return nil, err
+	}
+
+	tags := c.cluster.Tags
+	if tags == nil {
+		tags = []*ecs.Tag{}
+	}
+	return &ecs.ListTagsForResourceOutput{Tags: tags}, nil
+}
+
+func (s *Server) ecsTagResource(body []byte) (interface{}, *apiError) {
+	var in ecs.TagResourceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.ResourceArn))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range in.Tags {
+		c.untag(aws.StringValue(tag.Key))
+		c.cluster.Tags = append(c.cluster.Tags, tag)
+	}
+	return &ecs.TagResourceOutput{}, nil
+}
+
+func (s *Server) ecsUntagResource(body []byte) (interface{}, *apiError) {
+	var in ecs.UntagResourceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.ResourceArn))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range aws.StringValueSlice(in.TagKeys) {
+		c.untag(key)
+	}
+	return &ecs.UntagResourceOutput{}, nil
+}
+
+func (s *Server) ecsListServices(body []byte) (interface{}, *apiError) {
+	var in ecs.ListServicesInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, svc := range c.services {
+		if svc.status.peek() == "ACTIVE" {
+			names = append(names, name)
+		}
+	}
+
+	limit := int(aws.Int64Value(in.MaxResults))
+	if limit == 0 {
+		limit = 10
+	}
+	names, next, err := page(names, aws.StringValue(in.NextToken), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ecs.ListServicesOutput{ServiceArns: []*string{}}
+	for _, name := range names {
+		out.ServiceArns = append(out.ServiceArns, c.services[name].service.ServiceArn)
+	}
+	if next != "" {
+		out.NextToken = aws.String(next)
+	}
+	return out, nil
+}
+
+func (s *Server) ecsDescribeServices(body []byte) (interface{}, *apiError) {
+	var in ecs.DescribeServicesInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ecs.DescribeServicesOutput{
+		Services: []*ecs.Service{},
+		Failures: []*ecs.Failure{},
+	}
+	for _, name := range aws.StringValueSlice(in.Services) {
+		svc, ok := c.services[lastSegment(name, "service/")]
+		if !ok {
+			out.Failures = append(out.Failures, &ecs.Failure{
+				Arn:    aws.String(arn("ecs", "service/"+lastSegment(name, "service/"))),
+				Reason: aws.String("MISSING"),
+			})
+			continue
+		}
+		out.Services = append(out.Services, svc.observe())
+	}
+	return out, nil
+}
+
+func (s *Server) ecsUpdateService(body []byte) (interface{}, *apiError) {
+	var in ecs.UpdateServiceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	svc, err := s.activeService(aws.StringValue(in.Cluster), aws.StringValue(in.Service))
+	if err != nil {
+		return nil, err
+	}
+
+	if in.DesiredCount != nil {
+		svc.service.DesiredCount = in.DesiredCount
+	}
+	return &ecs.UpdateServiceOutput{Service: svc.service}, nil
+}
+
+func (s *Server) ecsDeleteService(body []byte) (interface{}, *apiError) {
+	var in ecs.DeleteServiceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	svc, err := s.activeService(aws.StringValue(in.Cluster), aws.StringValue(in.Service))
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.Int64Value(svc.service.DesiredCount) > 0 && !aws.BoolValue(in.Force) {
+		return nil, newError(400, "InvalidParameterException", "The service cannot be stopped while it is scaled above 0.")
+	}
+
+	svc.service.DesiredCount = aws.Int64(0)
+	svc.status.set("DRAINING", "INACTIVE")
+	svc.service.Status = aws.String(svc.status.peek())
+	return &ecs.DeleteServiceOutput{Service: svc.service}, nil
+}
+
+func (s *Server) ecsListTasks(body []byte) (interface{}, *apiError) {
+	var in ecs.ListTasksInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	desiredStatus := aws.StringValue(in.DesiredStatus)
+	if desiredStatus == "" {
+		desiredStatus = ecs.DesiredStatusRunning
+	}
+
+	var ids []string
+	for id, t := range c.tasks {
+		if in.ServiceName != nil && t.service != aws.StringValue(in.ServiceName) {
+			continue
+		}
+		if aws.StringValue(t.task.DesiredStatus) == desiredStatus {
+			ids = append(ids, id)
+		}
+	}
+
+	limit := int(aws.Int64Value(in.MaxResults))
+	if limit == 0 {
+		limit = 100
+	}
+	ids, next, err := page(ids, aws.StringValue(in.NextToken), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ecs.ListTasksOutput{TaskArns: []*string{}}
+	for _, id := range ids {
+		out.TaskArns = append(out.TaskArns, c.tasks[id].task.TaskArn)
+	}
+	if next != "" {
+		out.NextToken = aws.String(next)
+	}
+	return out, nil
+}
+
+func (s *Server) ecsDescribeTasks(body []byte) (interface{}, *apiError) {
+	var in ecs.DescribeTasksInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+	if len(in.Tasks) > 100 {
+		return nil, newError(400, "InvalidParameterException", "At most 100 tasks can be described at once.")
+	}
+
+	out := &ecs.DescribeTasksOutput{
+		Tasks:    []*ecs.Task{},
+		Failures: []*ecs.Failure{},
+	}
+	for _, id := range aws.StringValueSlice(in.Tasks) {
+		t, ok := c.tasks[lastSegment(id, "/")]
+		if !ok {
+			out.Failures = append(out.Failures, &ecs.Failure{
+				Arn:    aws.String(id),
+				Reason: aws.String("MISSING"),
+			})
+			continue
+		}
+		t.task.LastStatus = aws.String(t.status.observe())
+		out.Tasks = append(out.Tasks, t.task)
+	}
+	return out, nil
+}
+
+func (s *Server) ecsStopTask(body []byte) (interface{}, *apiError) {
+	var in ecs.StopTaskInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := c.tasks[lastSegment(aws.StringValue(in.Task), "/")]
+	if !ok {
+		return nil, newError(400, "InvalidParameterException", "The referenced task was not found.")
+	}
+
+	if aws.StringValue(t.task.DesiredStatus) != ecs.DesiredStatusStopped {
+		t.task.DesiredStatus = aws.String(ecs.DesiredStatusStopped)
+		t.task.StopCode = aws.String(ecs.TaskStopCodeUserInitiated)
+		t.task.StoppedReason = in.Reason
+		t.status.set("STOPPING", "STOPPED")
+		t.task.LastStatus = aws.String(t.status.peek())
+	}
+	return &ecs.StopTaskOutput{Task: t.task}, nil
+}
+
+func (s *Server) ecsListContainerInstances(body []byte) (interface{}, *apiError) {
+	var in ecs.ListContainerInstancesInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id, ci := range c.instances {
+		if in.Status == nil || aws.StringValue(ci.instance.Status) == aws.StringValue(in.Status) {
+			ids = append(ids, id)
+		}
+	}
+
+	limit := int(aws.Int64Value(in.MaxResults))
+	if limit == 0 {
+		limit = 100
+	}
+	ids, next, err := page(ids, aws.StringValue(in.NextToken), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ecs.ListContainerInstancesOutput{ContainerInstanceArns: []*string{}}
+	for _, id := range ids {
+		out.ContainerInstanceArns = append(out.ContainerInstanceArns, c.instances[id].instance.ContainerInstanceArn)
+	}
+	if next != "" {
+		out.NextToken = aws.String(next)
+	}
+	return out, nil
+}
+
+func (s *Server) ecsDescribeContainerInstances(body []byte) (interface{}, *apiError) {
+	var in ecs.DescribeContainerInstancesInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+	if len(in.ContainerInstances) > 100 {
+		return nil, newError(400, "InvalidParameterException", "At most 100 container instances can be described at once.")
+	}
+
+	out := &ecs.DescribeContainerInstancesOutput{
+		ContainerInstances: []*ecs.ContainerInstance{},
+		Failures:           []*ecs.Failure{},
+	}
+	for _, id := range aws.StringValueSlice(in.ContainerInstances) {
+		ci, ok := c.instances[lastSegment(id, "/")]
+		if !ok {
+			out.Failures = append(out.Failures, &ecs.Failure{
+				Arn:    aws.String(id),
+				Reason: aws.String("MISSING"),
+			})
+			continue
+		}
+		out.ContainerInstances = append(out.ContainerInstances, c.observeInstance(ci))
+	}
+	return out, nil
+}
+
+func (s *Server) ecsUpdateContainerInstancesState(body []byte) (interface{}, *apiError) {
+	var in ecs.UpdateContainerInstancesStateInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+	if len(in.ContainerInstances) > 10 {
+		return nil, newError(400, "InvalidParameterException", "At most 10 container instances can be updated at once.")
+	}
+
+	out := &ecs.UpdateContainerInstancesStateOutput{
+		ContainerInstances: []*ecs.ContainerInstance{},
+		Failures:           []*ecs.Failure{},
+	}
+	for _, id := range aws.StringValueSlice(in.ContainerInstances) {
+		ci, ok := c.instances[lastSegment(id, "/")]
+		if !ok {
+			out.Failures = append(out.Failures, &ecs.Failure{
+				Arn:    aws.String(id),
+				Reason: aws.String("MISSING"),
+			})
+			continue
+		}
+		ci.instance.Status = in.Status
+		out.ContainerInstances = append(out.ContainerInstances, ci.instance)
+	}
+	return out, nil
+}
+
+func (s *Server) ecsDeregisterContainerInstance(body []byte) (interface{}, *apiError) {
+	var in ecs.DeregisterContainerInstanceInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	c, err := s.cluster(aws.StringValue(in.Cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	id := lastSegment(aws.StringValue(in.ContainerInstance), "/")
+	ci, ok := c.instances[id]
+	if !ok {
+		return nil, newError(400, "InvalidParameterException", "The referenced container instance is not registered.")
+	}
+	if aws.Int64Value(ci.instance.RunningTasksCount) > 0 && !aws.BoolValue(in.Force) {
+		return nil, newError(400, "InvalidParameterException",
+			"The specified container instance has tasks running. Stop them, or deregister it with force.")
+	}
+
+	delete(c.instances, id)
+	ci.instance.Status = aws.String("INACTIVE")
+	return &ecs.DeregisterContainerInstanceOutput{ContainerInstance: ci.instance}, nil
+}
+
+func (s *Server) cluster(nameOrArn string) (*cluster, *apiError) {
+	if nameOrArn == "" {
+		nameOrArn = "default"
+	}
+
+	c, ok := s.clusters[lastSegment(nameOrArn, "cluster/")]
+	if !ok || c.status.peek() == "INACTIVE" {
+		return nil, newError(400, "ClusterNotFoundException", "Cluster not found.")
+	}
+	return c, nil
+}
+
+func (s *Server) activeService(clusterNameOrArn, serviceNameOrArn string) (*service, *apiError) {
+	c, err := s.cluster(clusterNameOrArn)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, ok := c.services[lastSegment(serviceNameOrArn, "service/")]
+	if !ok {
+		return nil, newError(400, "ServiceNotFoundException", "Service not found.")
+	}
+	if svc.status.peek() != "ACTIVE" {
+		return nil, newError(400, "ServiceNotActiveException", "Service was not ACTIVE.")
+	}
+	return svc, nil
+}
+
+// untag removes the tag with the given key from the cluster.
+func (c *cluster) untag(key string) {
+	for i, tag := range c.cluster.Tags {
+		if aws.StringValue(tag.Key) == key {
+			c.cluster.Tags = append(c.cluster.Tags[:i], c.cluster.Tags[i+1:]...)
+			return
+		}
+	}
+}
+
+// updateSettings sets the given settings of the cluster, leaving the others
+// as they are.
+func (c *cluster) updateSettings(settings []*ecs.ClusterSetting) {
+	for _, setting := range settings {
+		found := false
+		for _, current := range c.cluster.Settings {
+			if aws.StringValue(current.Name) == aws.StringValue(setting.Name) {
+				current.Value = setting.Value
+				found = true
+			}
+		}
+		if !found {
+			c.cluster.Settings = append(c.cluster.Settings, setting)
+		}
+	}
+}
+
+// describe returns a copy of the cluster with its current status and counts,
+// moving the status on when observe is set. The tags and settings are only
+// included when listed in include, like the fields of DescribeClusters.
+func (c *cluster) describe(observe bool, include ...string) *ecs.Cluster {
+	clusterStatus := c.status.peek()
+	if observe {
+		clusterStatus = c.status.observe()
+	}
+	c.cluster.Status = aws.String(clusterStatus)
+
+	if c.attachments != nil {
+		attachmentsStatus := c.attachments.peek()
+		if observe {
+			attachmentsStatus = c.attachments.observe()
+		}
+		c.cluster.AttachmentsStatus = aws.String(attachmentsStatus)
+	}
+
+	var active, running, pending int64
+	for _, svc := range c.services {
+		if svc.status.peek() == "ACTIVE" {
+			active++
+		}
+		running += aws.Int64Value(svc.service.RunningCount)
+		pending += aws.Int64Value(svc.service.PendingCount)
+	}
+	// The running count of the services covers their tasks
+	for _, t := range c.tasks {
+		if t.service == "" && t.status.peek() != "STOPPED" {
+			running++
+		}
+	}
+	c.cluster.ActiveServicesCount = aws.Int64(active)
+	c.cluster.RunningTasksCount = aws.Int64(running)
+	c.cluster.PendingTasksCount = aws.Int64(pending)
+	c.cluster.RegisteredContainerInstancesCount = aws.Int64(int64(len(c.instances)))
+
+	described := *c.cluster
+	if !containsString(include, ecs.ClusterFieldTags) {
+		described.Tags = nil
+	}
+	if !containsString(include, ecs.ClusterFieldSettings) {
+		described.Settings = nil
+	}
+	return &described
+}
+
+// observeInstance returns the container instance with its current count of
+// running tasks: its service tasks and the standalone tasks placed on it that
+// are not STOPPED. The service tasks of a DRAINING instance are gone once it
+// has been observed; standalone tasks have to be stopped.
+func (c *cluster) observeInstance(ci *containerInstance) *ecs.ContainerInstance {
+	running := ci.serviceTasks
+	for _, t := range c.tasks {
+		if aws.StringValue(t.task.ContainerInstanceArn) == aws.StringValue(ci.instance.ContainerInstanceArn) &&
+			t.status.peek() != "STOPPED" {
+			running++
+		}
+	}
+	ci.instance.RunningTasksCount = aws.Int64(running)
+
+	if aws.StringValue(ci.instance.Status) == ecs.ContainerInstanceStatusDraining {
+		ci.serviceTasks = 0
+	}
+	return ci.instance
+}
+
+// observe returns a copy of the service with its current status and running
+// count, and moves it on to its next status, and its running count to its
+// desired count.
+func (svc *service) observe() *ecs.Service {
+	svc.service.Status = aws.String(svc.status.observe())
+	described := *svc.service
+	svc.service.RunningCount = svc.service.DesiredCount
+
+	for i, t := range svc.tasks {
+		if int64(i) >= aws.Int64Value(svc.service.DesiredCount) && t.status.peek() != "STOPPED" {
+			t.task.DesiredStatus = aws.String(ecs.DesiredStatusStopped)
+			t.task.StopCode = aws.String(ecs.TaskStopCodeServiceSchedulerInitiated)
+			t.status.set("STOPPED")
+			t.task.LastStatus = aws.String(t.status.peek())
+		}
+	}
+	return &described
+}
@@ -0,0 +1,304 @@
+package fakeaws
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// queryOperation handles an action of a query protocol service, taking the
+// form parameters and returning the <Action>Result element to encode, if the
+// action has any result.
+type queryOperation func(s *Server, params url.Values) (interface{}, *apiError)
+
+// queryService is a query protocol service, whose actions are all posted to
+// the same URL.
+type queryService struct {
+	namespace  string
+	operations map[string]queryOperation
+}
+
+var queryServices = []queryService{
+	{
+		namespace: "https://iam.amazonaws.com/doc/2010-05-08/",
+		operations: map[string]queryOperation{
+			"AddUserToGroup":      (*Server).iamAddUserToGroup,
+			"CreateGroup":         (*Server).iamCreateGroup,
+			"DeleteGroup":         (*Server).iamDeleteGroup,
+			"GetGroup":            (*Server).iamGetGroup,
+			"RemoveUserFromGroup": (*Server).iamRemoveUserFromGroup,
+			"UpdateGroup":         (*Server).iamUpdateGroup,
+		},
+	},
+	{
+		namespace: "https://sts.amazonaws.com/doc/2011-06-15/",
+		operations: map[string]queryOperation{
+			"GetCallerIdentity": (*Server).stsGetCallerIdentity,
+		},
+	},
+}
+
+// group is an IAM group and the names of its members.
+type group struct {
+	group *iamGroup
+	users map[string]bool
+}
+
+// user is an IAM user, which can only be seeded.
+type user struct {
+	user *iamUser
+}
+
+type iamGroup struct {
+	Path       string
+	GroupName  string
+	GroupId    string
+	Arn        string
+	CreateDate string
+}
+
+type iamUser struct {
+	Path       string
+	UserName   string
+	UserId     string
+	Arn        string
+	CreateDate string
+}
+
+type createGroupResult struct {
+	XMLName xml.Name `xml:"CreateGroupResult"`
+	Group   *iamGroup
+}
+
+type getGroupResult struct {
+	XMLName     xml.Name `xml:"GetGroupResult"`
+	Group       *iamGroup
+	Users       []*iamUser `xml:"Users>member"`
+	IsTruncated bool
+	Marker      string `xml:",omitempty"`
+}
+
+type getCallerIdentityResult struct {
+	XMLName xml.Name `xml:"GetCallerIdentityResult"`
+	Account string
+	Arn     string
+	UserId  string
+}
+
+// AddIAMUser adds a user, member of the given groups created through the
+// provider.
+func (s *Server) AddIAMUser(userName string, groupNames ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, groupName := range groupNames {
+		if _, ok := s.groups[groupName]; !ok {
+			return fmt.Errorf("NoSuchEntity: The group with name %s cannot be found.", groupName)
+		}
+	}
+
+	s.users[userName] = &user{
+		user: &iamUser{
+			Path:       "/",
+			UserName:   userName,
+			UserId:     "AIDA" + s.nextID(17),
+			Arn:        fmt.Sprintf("arn:aws:iam::%s:user/%s", AccountID, userName),
+			CreateDate: now().Format(time.RFC3339),
+		},
+	}
+	for _, groupName := range groupNames {
+		s.groups[groupName].users[userName] = true
+	}
+	return nil
+}
+
+func (s *Server) serveQuery(w http.ResponseWriter, requestID string, body []byte) {
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeQueryError(w, requestID, "", newError(400, "MalformedQueryString", "%s", err))
+		return
+	}
+
+	action := params.Get("Action")
+	for _, service := range queryServices {
+		operation, ok := service.operations[action]
+		if !ok {
+			continue
+		}
+
+		result, apiErr := operation(s, params)
+		if apiErr != nil {
+			writeQueryError(w, requestID, service.namespace, apiErr)
+			return
+		}
+
+		var inner []byte
+		if result != nil {
+			if inner, err = xml.Marshal(result); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<%sResponse xmlns="%s">%s<ResponseMetadata><RequestId>%s</RequestId></ResponseMetadata></%sResponse>`,
+			action, service.namespace, inner, requestID, action)
+		return
+	}
+
+	writeQueryError(w, requestID, "", newError(400, "InvalidAction", "Could not find operation %s", action))
+}
+
+func writeQueryError(w http.ResponseWriter, requestID, namespace string, e *apiError) {
+	var message bytes.Buffer
+	xml.EscapeText(&message, []byte(e.message))
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(e.status)
+	fmt.Fprintf(w, `<ErrorResponse xmlns="%s"><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>%s</RequestId></ErrorResponse>`,
+		namespace, e.code, message.String(), requestID)
+}
+
+func (s *Server) iamCreateGroup(params url.Values) (interface{}, *apiError) {
+	name := params.Get("GroupName")
+	if _, ok := s.groups[name]; ok {
+		return nil, newError(409, "EntityAlreadyExists", "Group with name %s already exists.", name)
+	}
+
+	path := params.Get("Path")
+	if path == "" {
+		path = "/"
+	}
+
+	g := &group{
+		group: &iamGroup{
+			Path:       path,
+			GroupName:  name,
+			GroupId:    "AGPA" + s.nextID(17),
+			Arn:        fmt.Sprintf("arn:aws:iam::%s:group%s%s", AccountID, path, name),
+			CreateDate: now().Format(time.RFC3339),
+		},
+		users: make(map[string]bool),
+	}
+	s.groups[name] = g
+	return &createGroupResult{Group: g.group}, nil
+}
+
+func (s *Server) iamGetGroup(params url.Values) (interface{}, *apiError) {
+	g, err := s.group(params.Get("GroupName"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range g.users {
+		names = append(names, name)
+	}
+
+	limit := 100
+	if maxItems := params.Get("MaxItems"); maxItems != "" {
+		limit, _ = strconv.Atoi(maxItems)
+	}
+	names, marker, err := page(names, params.Get("Marker"), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &getGroupResult{
+		Group:       g.group,
+		Users:       []*iamUser{},
+		IsTruncated: marker != "",
+		Marker:      marker,
+	}
+	for _, name := range names {
+		result.Users = append(result.Users, s.users[name].user)
+	}
+	return result, nil
+}
+
+func (s *Server) iamUpdateGroup(params url.Values) (interface{}, *apiError) {
+	name := params.Get("GroupName")
+	g, err := s.group(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if newPath := params.Get("NewPath"); newPath != "" {
+		g.group.Path = newPath
+	}
+	if newName := params.Get("NewGroupName"); newName != "" && newName != name {
+		if _, ok := s.groups[newName]; ok {
+			return nil, newError(409, "EntityAlreadyExists", "Group with name %s already exists.", newName)
+		}
+		delete(s.groups, name)
+		g.group.GroupName = newName
+		s.groups[newName] = g
+	}
+	g.group.Arn = fmt.Sprintf("arn:aws:iam::%s:group%s%s", AccountID, g.group.Path, g.group.GroupName)
+	return nil, nil
+}
+
+func (s *Server) iamDeleteGroup(params url.Values) (interface{}, *apiError) {
+	name := params.Get("GroupName")
+	g, err := s.group(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(g.users) > 0 {
+		return nil, newError(409, "DeleteConflict", "Cannot delete entity, must remove users from group first.")
+	}
+
+	delete(s.groups, name)
+	return nil, nil
+}
+
+func (s *Server) iamAddUserToGroup(params url.Values) (interface{}, *apiError) {
+	g, err := s.group(params.Get("GroupName"))
+	if err != nil {
+		return nil, err
+	}
+
+	userName := params.Get("UserName")
+	if _, ok := s.users[userName]; !ok {
+		return nil, newError(404, "NoSuchEntity", "The user with name %s cannot be found.", userName)
+	}
+
+	g.users[userName] = true
+	return nil, nil
+}
+
+func (s *Server) iamRemoveUserFromGroup(params url.Values) (interface{}, *apiError) {
+	g, err := s.group(params.Get("GroupName"))
+	if err != nil {
+		return nil, err
+	}
+
+	userName := params.Get("UserName")
+	if !g.users[userName] {
+		return nil, newError(404, "NoSuchEntity", "The user with name %s cannot be found.", userName)
+	}
+
+	delete(g.users, userName)
+	return nil, nil
+}
+
+func (s *Server) group(name string) (*group, *apiError) {
+	g, ok := s.groups[name]
+	if !ok {
+		return nil, newError(404, "NoSuchEntity", "The group with name %s cannot be found.", name)
+	}
+	return g, nil
+}
+
+func (s *Server) stsGetCallerIdentity(params url.Values) (interface{}, *apiError) {
+	return &getCallerIdentityResult{
+		Account: AccountID,
+		Arn:     fmt.Sprintf("arn:aws:iam::%s:user/fake", AccountID),
+		UserId:  "AIDAFAKEFAKEFAKEFAKE",
+	}, nil
+}
@@ -0,0 +1,136 @@
+package fakeaws
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+var kmsOperations = map[string]jsonOperation{
+	"CreateGrant": (*Server).kmsCreateGrant,
+	"ListGrants":  (*Server).kmsListGrants,
+	"RevokeGrant": (*Server).kmsRevokeGrant,
+}
+
+// key is a KMS key and its grants, by grant ID.
+type key struct {
+	arn    string
+	grants map[string]*kms.GrantListEntry
+}
+
+// AddKMSKey adds a key with the given ID, and returns its ARN.
+func (s *Server) AddKMSKey(keyID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := &key{
+		arn:    arn("kms", "key/"+keyID),
+		grants: make(map[string]*kms.GrantListEntry),
+	}
+	s.keys[keyID] = k
+	return k.arn
+}
+
+func (s *Server) kmsCreateGrant(body []byte) (interface{}, *apiError) {
+	var in kms.CreateGrantInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	k, err := s.key(aws.StringValue(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+
+	// KMS lists the operations of a grant in an order of its own, not in
+	// the one they were given in
+	operations := aws.StringValueSlice(in.Operations)
+	sort.Strings(operations)
+
+	grantID := s.nextID(64)
+	k.grants[grantID] = &kms.GrantListEntry{
+		GrantId:           aws.String(grantID),
+		KeyId:             aws.String(k.arn),
+		Name:              in.Name,
+		GranteePrincipal:  in.GranteePrincipal,
+		RetiringPrincipal: in.RetiringPrincipal,
+		Operations:        aws.StringSlice(operations),
+		Constraints:       in.Constraints,
+		IssuingAccount:    aws.String("arn:aws:iam::" + AccountID + ":root"),
+		CreationDate:      now(),
+	}
+
+	return &kms.CreateGrantOutput{
+		GrantId:    aws.String(grantID),
+		GrantToken: aws.String("token-" + grantID),
+	}, nil
+}
+
+func (s *Server) kmsListGrants(body []byte) (interface{}, *apiError) {
+	var in kms.ListGrantsInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	k, err := s.key(aws.StringValue(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+
+	var grantIDs []string
+	for grantID := range k.grants {
+		if in.GrantId == nil || aws.StringValue(in.GrantId) == grantID {
+			grantIDs = append(grantIDs, grantID)
+		}
+	}
+
+	limit := int(aws.Int64Value(in.Limit))
+	if limit == 0 {
+		limit = 50
+	}
+	grantIDs, next, err := page(grantIDs, aws.StringValue(in.Marker), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &kms.ListGrantsResponse{
+		Grants:    []*kms.GrantListEntry{},
+		Truncated: aws.Bool(next != ""),
+	}
+	for _, grantID := range grantIDs {
+		out.Grants = append(out.Grants, k.grants[grantID])
+	}
+	if next != "" {
+		out.NextMarker = aws.String(next)
+	}
+	return out, nil
+}
+
+func (s *Server) kmsRevokeGrant(body []byte) (interface{}, *apiError) {
+	var in kms.RevokeGrantInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	k, err := s.key(aws.StringValue(in.KeyId))
+	if err != nil {
+		return nil, err
+	}
+
+	grantID := aws.StringValue(in.GrantId)
+	if _, ok := k.grants[grantID]; !ok {
+		return nil, newError(400, "NotFoundException", "Grant ID %s not found", grantID)
+	}
+
+	delete(k.grants, grantID)
+	return &kms.RevokeGrantOutput{}, nil
+}
+
+func (s *Server) key(keyIDOrArn string) (*key, *apiError) {
+	k, ok := s.keys[lastSegment(keyIDOrArn, "key/")]
+	if !ok {
+		return nil, newError(400, "NotFoundException", "Key '%s' does not exist", keyIDOrArn)
+	}
+	return k, nil
+}
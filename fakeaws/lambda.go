@@ -0,0 +1,154 @@
+package fakeaws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// function is a Lambda function and the statements of its resource policy.
+type function struct {
+	arn        string
+	statements []*policyStatement
+	revision   int
+}
+
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Principal struct {
+		Service string
+	}
+	Action    string
+	Resource  string
+	Condition struct {
+		StringEquals struct {
+			SourceAccount string `json:"AWS:SourceAccount,omitempty"`
+		}
+		ArnLike struct {
+			SourceArn string `json:"AWS:SourceArn,omitempty"`
+		}
+	}
+}
+
+type policyDocument struct {
+	Version   string
+	Id        string
+	Statement []*policyStatement
+}
+
+// AddLambdaFunction adds a function without any resource policy, and returns
+// its ARN.
+func (s *Server) AddLambdaFunction(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := &function{arn: arn("lambda", "function:"+name)}
+	s.functions[name] = f
+	return f.arn
+}
+
+// serveLambda serves the permission operations under
+// /2015-03-31/functions/{FunctionName}/policy.
+func (s *Server) serveLambda(w http.ResponseWriter, r *http.Request, body []byte) {
+	segments := pathSegments(r)
+	if len(segments) < 4 || segments[3] != "policy" {
+		writeRESTError(w, newError(404, "UnknownOperationException", "Operation %s %s is not faked", r.Method, r.URL.Path))
+		return
+	}
+
+	f, ok := s.functions[lastSegment(segments[2], "function:")]
+	if !ok {
+		writeRESTError(w, newError(404, "ResourceNotFoundException", "Function not found: %s", segments[2]))
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && len(segments) == 4:
+		s.lambdaAddPermission(w, f, body)
+	case r.Method == "GET" && len(segments) == 4:
+		s.lambdaGetPolicy(w, f)
+	case r.Method == "DELETE" && len(segments) == 5:
+		s.lambdaRemovePermission(w, f, segments[4])
+	default:
+		writeRESTError(w, newError(404, "UnknownOperationException", "Operation %s %s is not faked", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) lambdaAddPermission(w http.ResponseWriter, f *function, body []byte) {
+	var in lambda.AddPermissionInput
+	if err := decodeJSON(body, &in); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	sid := aws.StringValue(in.StatementId)
+	for _, statement := range f.statements {
+		if statement.Sid == sid {
+			writeRESTError(w, newError(409, "ResourceConflictException",
+				"The statement id (%s) provided already exists. Please provide a new statement id, or remove the existing statement.", sid))
+			return
+		}
+	}
+
+	statement := &policyStatement{
+		Sid:      sid,
+		Effect:   "Allow",
+		Action:   aws.StringValue(in.Action),
+		Resource: f.arn,
+	}
+	statement.Principal.Service = aws.StringValue(in.Principal)
+	statement.Condition.StringEquals.SourceAccount = aws.StringValue(in.SourceAccount)
+	statement.Condition.ArnLike.SourceArn = aws.StringValue(in.SourceArn)
+	f.statements = append(f.statements, statement)
+	f.revision++
+
+	encoded, _ := json.Marshal(statement)
+	writeJSON(w, http.StatusCreated, &lambda.AddPermissionOutput{Statement: aws.String(string(encoded))})
+}
+
+func (s *Server) lambdaGetPolicy(w http.ResponseWriter, f *function) {
+	if len(f.statements) == 0 {
+		writeRESTError(w, newError(404, "ResourceNotFoundException", "The resource you requested does not exist."))
+		return
+	}
+
+	encoded, _ := json.Marshal(&policyDocument{
+		Version:   "2012-10-17",
+		Id:        "default",
+		Statement: f.statements,
+	})
+	writeJSON(w, http.StatusOK, &lambda.GetPolicyOutput{
+		Policy:     aws.String(string(encoded)),
+		RevisionId: aws.String(strconv.Itoa(f.revision)),
+	})
+}
+
+func (s *Server) lambdaRemovePermission(w http.ResponseWriter, f *function, sid string) {
+	for i, statement := range f.statements {
+		if statement.Sid == sid {
+			f.statements = append(f.statements[:i], f.statements[i+1:]...)
+			f.revision++
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeRESTError(w, newError(404, "ResourceNotFoundException", "The resource you requested does not exist."))
+}
+
+// pathSegments returns the unescaped segments of the request path.
+func pathSegments(r *http.Request) []string {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	return segments
+}
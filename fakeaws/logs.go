@@ -0,0 +1,208 @@
+package fakeaws
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+var logsOperations = map[string]jsonOperation{
+	"DeleteSubscriptionFilter":    (*Server).logsDeleteSubscriptionFilter,
+	"DescribeSubscriptionFilters": (*Server).logsDescribeSubscriptionFilters,
+	"PutSubscriptionFilter":       (*Server).logsPutSubscriptionFilter,
+}
+
+var kinesisOperations = map[string]jsonOperation{
+	"DescribeStream": (*Server).kinesisDescribeStream,
+}
+
+// maxSubscriptionFilters is the number of subscription filters a log group
+// can have.
+const maxSubscriptionFilters = 2
+
+// logGroup is a CloudWatch Logs log group and its subscription filters, by
+// name.
+type logGroup struct {
+	filters map[string]*cloudwatchlogs.SubscriptionFilter
+}
+
+// stream is a Kinesis stream, which is CREATING the first time it is
+// observed.
+type stream struct {
+	arn    string
+	status *status
+}
+
+// AddLogGroup adds a log group.
+func (s *Server) AddLogGroup(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logGroups[name] = &logGroup{
+		filters: make(map[string]*cloudwatchlogs.SubscriptionFilter),
+	}
+}
+
+// AddKinesisStream adds a stream, and returns its ARN.
+func (s *Server) AddKinesisStream(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &stream{
+		arn:    arn("kinesis", "stream/"+name),
+		status: newStatus(kinesis.StreamStatusCreating, kinesis.StreamStatusActive),
+	}
+	s.streams[name] = st
+	return st.arn
+}
+
+func (s *Server) logsPutSubscriptionFilter(body []byte) (interface{}, *apiError) {
+	var in cloudwatchlogs.PutSubscriptionFilterInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	g, err := s.logGroup(aws.StringValue(in.LogGroupName))
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.FilterName)
+	if _, ok := g.filters[name]; !ok && len(g.filters) >= maxSubscriptionFilters {
+		return nil, newError(400, "LimitExceededException", "Resource limit exceeded.")
+	}
+
+	// Like on AWS, a test message is delivered to the destination first
+	if !s.canDeliver(aws.StringValue(in.DestinationArn), aws.StringValue(in.LogGroupName)) {
+		return nil, newError(400, "InvalidParameterException", "Could not deliver test message to specified destination. "+
+			"Check if the destination is valid.")
+	}
+
+	g.filters[name] = &cloudwatchlogs.SubscriptionFilter{
+		FilterName:     in.FilterName,
+		LogGroupName:   in.LogGroupName,
+		FilterPattern:  in.FilterPattern,
+		DestinationArn: in.DestinationArn,
+		RoleArn:        in.RoleArn,
+		Distribution:   aws.String(cloudwatchlogs.DistributionByLogStream),
+		CreationTime:   aws.Int64(now().Unix() * 1000),
+	}
+	return &cloudwatchlogs.PutSubscriptionFilterOutput{}, nil
+}
+
+func (s *Server) logsDescribeSubscriptionFilters(body []byte) (interface{}, *apiError) {
+	var in cloudwatchlogs.DescribeSubscriptionFiltersInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	g, err := s.logGroup(aws.StringValue(in.LogGroupName))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range g.filters {
+		if strings.HasPrefix(name, aws.StringValue(in.FilterNamePrefix)) {
+			names = append(names, name)
+		}
+	}
+
+	names, next, err := page(names, aws.StringValue(in.NextToken), int(aws.Int64Value(in.Limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudwatchlogs.DescribeSubscriptionFiltersOutput{
+		SubscriptionFilters: []*cloudwatchlogs.SubscriptionFilter{},
+	}
+	for _, name := range names {
+		out.SubscriptionFilters = append(out.SubscriptionFilters, g.filters[name])
+	}
+	if next != "" {
+		out.NextToken = aws.String(next)
+	}
+	return out, nil
+}
+
+func (s *Server) logsDeleteSubscriptionFilter(body []byte) (interface{}, *apiError) {
+	var in cloudwatchlogs.DeleteSubscriptionFilterInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	g, err := s.logGroup(aws.StringValue(in.LogGroupName))
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.FilterName)
+	if _, ok := g.filters[name]; !ok {
+		return nil, newError(400, "ResourceNotFoundException", "The specified subscription filter does not exist.")
+	}
+
+	delete(g.filters, name)
+	return &cloudwatchlogs.DeleteSubscriptionFilterOutput{}, nil
+}
+
+func (s *Server) logGroup(name string) (*logGroup, *apiError) {
+	g, ok := s.logGroups[name]
+	if !ok {
+		return nil, newError(400, "ResourceNotFoundException", "The specified log group does not exist.")
+	}
+	return g, nil
+}
+
+// canDeliver tells whether a subscription filter of the log group can send
+// to the destination: an ACTIVE Kinesis stream, or a Lambda function whose
+// policy allows CloudWatch Logs to invoke it.
+func (s *Server) canDeliver(destinationArn, logGroupName string) bool {
+	switch {
+	case strings.HasPrefix(destinationArn, "arn:aws:kinesis:"):
+		st, ok := s.streams[lastSegment(destinationArn, "stream/")]
+		return ok && st.status.peek() == kinesis.StreamStatusActive
+
+	case strings.HasPrefix(destinationArn, "arn:aws:lambda:"):
+		f, ok := s.functions[lastSegment(destinationArn, "function:")]
+		if !ok {
+			return false
+		}
+		for _, statement := range f.statements {
+			if strings.HasPrefix(statement.Principal.Service, "logs.") &&
+				strings.Contains(statement.Condition.ArnLike.SourceArn, ":log-group:"+logGroupName+":") {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) kinesisDescribeStream(body []byte) (interface{}, *apiError) {
+	var in kinesis.DescribeStreamInput
+	if err := decodeJSON(body, &in); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(in.StreamName)
+	st, ok := s.streams[name]
+	if !ok {
+		return nil, newError(400, "ResourceNotFoundException", "Stream %s under account %s not found.", name, AccountID)
+	}
+
+	return &kinesis.DescribeStreamOutput{
+		StreamDescription: &kinesis.StreamDescription{
+			StreamName:              aws.String(name),
+			StreamARN:               aws.String(st.arn),
+			StreamStatus:            aws.String(st.status.observe()),
+			Shards:                  []*kinesis.Shard{},
+			HasMoreShards:           aws.Bool(false),
+			RetentionPeriodHours:    aws.Int64(24),
+			EnhancedMonitoring:      []*kinesis.EnhancedMetrics{},
+			StreamCreationTimestamp: now(),
+		},
+	}, nil
+}
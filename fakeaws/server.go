@@ -0,0 +1,341 @@
+// Package fakeaws is an in-memory fake of the parts of the AWS APIs used by
+// the dashsoftaws resources: API Gateway, CloudWatch Logs, DynamoDB, ECS, IAM,
+// Kinesis, KMS, Lambda and STS. It serves all of them from one local HTTP
+// server, so the provider can be pointed at it through the endpoints block
+// and resources can be applied and destroyed without an AWS account.
+//
+// Resources go through the same transitional states as on AWS (a DynamoDB
+// table is CREATING before it is ACTIVE, a deleted ECS cluster is
+// DEPROVISIONING before it is INACTIVE, ...). Each time such a resource is
+// observed through a Describe or Get call it moves on to its next state, so
+// the waits of the resources take a deterministic number of polls.
+//
+// Things the provider expects to exist rather than creates, such as REST
+// APIs, log groups, Lambda functions or KMS keys, are seeded with the Add
+// methods of Server.
+package fakeaws
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/apigateway"
+)
+
+const (
+	// AccountID is the account every fake resource belongs to
+	AccountID = "123456789012"
+
+	// Region is the region every fake resource lives in
+	Region = "us-east-1"
+)
+
+// endpointServiceNames are the services of the provider endpoints block the
+// server fakes.
+var endpointServiceNames = []string{
+	"apigateway",
+	"cloudwatchlogs",
+	"dynamodb",
+	"ecs",
+	"iam",
+	"kinesis",
+	"kms",
+	"lambda",
+	"sts",
+}
+
+// Server is a running fake AWS backend.
+type Server struct {
+	// URL is the endpoint of every faked service
+	URL string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests int
+	ids      int
+
+	domainNames        map[string]*domainName
+	clientCertificates map[string]*apigateway.ClientCertificate
+	restAPIs           map[string]*restAPI
+	tables             map[string]*table
+	clusters           map[string]*cluster
+	groups             map[string]*group
+	users              map[string]*user
+	keys               map[string]*key
+	logGroups          map[string]*logGroup
+	streams            map[string]*stream
+	functions          map[string]*function
+}
+
+// NewServer starts a fake AWS backend listening on a local port. It must be
+// closed with Close.
+func NewServer() *Server {
+	s := &Server{
+		domainNames:        make(map[string]*domainName),
+		clientCertificates: make(map[string]*apigateway.ClientCertificate),
+		restAPIs:           make(map[string]*restAPI),
+		tables:             make(map[string]*table),
+		clusters:           make(map[string]*cluster),
+		groups:             make(map[string]*group),
+		users:              make(map[string]*user),
+		keys:               make(map[string]*key),
+		logGroups:          make(map[string]*logGroup),
+		streams:            make(map[string]*stream),
+		functions:          make(map[string]*function),
+	}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Endpoints returns the endpoints block of the provider configuration, by
+// service name, pointing every faked service at the server.
+func (s *Server) Endpoints() map[string]string {
+	endpoints := make(map[string]string, len(endpointServiceNames))
+	for _, service := range endpointServiceNames {
+		endpoints[service] = s.URL
+	}
+	return endpoints
+}
+
+// ProviderConfig returns a provider block using the server for every faked
+// service, with dummy credentials and without any call to the EC2 metadata
+// API, to prepend to the configuration of a resource.Test step.
+func (s *Server) ProviderConfig() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "provider \"dashsoftaws\" {\n")
+	fmt.Fprintf(&b, "  region                  = %q\n", Region)
+	fmt.Fprintf(&b, "  access_key              = \"fake\"\n")
+	fmt.Fprintf(&b, "  secret_key              = \"fake\"\n")
+	fmt.Fprintf(&b, "  skip_metadata_api_check = true\n")
+	fmt.Fprintf(&b, "  max_retries             = 25\n")
+	fmt.Fprintf(&b, "  retry_base_delay_ms     = 1\n")
+	fmt.Fprintf(&b, "  retry_max_delay_ms      = 10\n")
+	fmt.Fprintf(&b, "\n  endpoints {\n")
+	for _, service := range endpointServiceNames {
+		fmt.Fprintf(&b, "    %-14s = %q\n", service, s.URL)
+	}
+	fmt.Fprintf(&b, "  }\n}\n")
+	return b.String()
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	requestID := fmt.Sprintf("fake-%08d", s.requests)
+	w.Header().Set("X-Amzn-Requestid", requestID)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	switch {
+	case target != "":
+		s.serveJSON(w, target, body)
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded"):
+		s.serveQuery(w, requestID, body)
+	case strings.HasPrefix(r.URL.Path, "/2015-03-31/functions/"):
+		s.serveLambda(w, r, body)
+	default:
+		s.serveAPIGateway(w, r, body)
+	}
+}
+
+// apiError is an error returned to the client in the format of the protocol
+// of the service.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func newError(status int, code, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// jsonOperation handles an operation of a JSON protocol service, taking the
+// request body and returning the output to encode.
+type jsonOperation func(s *Server, body []byte) (interface{}, *apiError)
+
+// jsonServices maps the target prefix of the JSON protocol services to their
+// operations.
+var jsonServices = map[string]map[string]jsonOperation{
+	"DynamoDB_20120810":                  dynamodbOperations,
+	"AmazonEC2ContainerServiceV20141113": ecsOperations,
+	"Kinesis_20131202":                   kinesisOperations,
+	"Logs_20140328":                      logsOperations,
+	"TrentService":                       kmsOperations,
+}
+
+func (s *Server) serveJSON(w http.ResponseWriter, target string, body []byte) {
+	parts := strings.SplitN(target, ".", 2)
+	operations, ok := jsonServices[parts[0]]
+	if !ok || len(parts) != 2 {
+		writeJSONError(w, newError(400, "UnknownOperationException", "Unknown service %s", parts[0]))
+		return
+	}
+
+	operation, ok := operations[parts[1]]
+	if !ok {
+		writeJSONError(w, newError(400, "UnknownOperationException", "Operation %s is not faked", target))
+		return
+	}
+
+	out, apiErr := operation(s, body)
+	if apiErr != nil {
+		writeJSONError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := jsonutil.BuildJSON(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeJSONError(w http.ResponseWriter, e *apiError) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(e.status)
+	fmt.Fprintf(w, `{"__type":%q,"message":%q}`, e.code, e.message)
+}
+
+// writeRESTError writes an error of the REST-JSON services, API Gateway and
+// Lambda, which carry the code in a header.
+func writeRESTError(w http.ResponseWriter, e *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-Errortype", e.code)
+	w.WriteHeader(e.status)
+	fmt.Fprintf(w, `{"message":%q}`, e.message)
+}
+
+func decodeJSON(body []byte, v interface{}) *apiError {
+	if err := jsonutil.UnmarshalJSON(v, strings.NewReader(string(body))); err != nil {
+		return newError(400, "SerializationException", "%s", err)
+	}
+	return nil
+}
+
+// nextID returns a new identifier of the given length, made of lowercase
+// letters and digits like the ones API Gateway hands out.
+func (s *Server) nextID(length int) string {
+	s.ids++
+	id := strconv.FormatInt(int64(s.ids), 36)
+	if len(id) < length {
+		id = strings.Repeat("0", length-len(id)) + id
+	}
+	return id
+}
+
+func arn(service, resource string) string {
+	return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, Region, AccountID, resource)
+}
+
+func now() *time.Time {
+	t := time.Now().UTC().Truncate(time.Second)
+	return &t
+}
+
+// status is the status of a resource moving through transitional states.
+// Every time it is observed it moves on to its next state, until it reaches
+// the last one. The empty state stands for a resource that is gone.
+type status struct {
+	states []string
+}
+
+func newStatus(states ...string) *status {
+	return &status{states: states}
+}
+
+// set replaces the states still to come.
+func (st *status) set(states ...string) {
+	st.states = states
+}
+
+// peek returns the current state without moving on.
+func (st *status) peek() string {
+	return st.states[0]
+}
+
+// observe returns the current state and moves on to the next one.
+func (st *status) observe() string {
+	current := st.states[0]
+	if len(st.states) > 1 {
+		st.states = st.states[1:]
+	}
+	return current
+}
+
+// page returns the names of the page starting at token, and the token of the
+// next page, if any.
+func page(names []string, token string, limit int) ([]string, string, *apiError) {
+	sort.Strings(names)
+
+	start := 0
+	if token != "" {
+		var err error
+		if start, err = strconv.Atoi(token); err != nil || start < 0 || start > len(names) {
+			return nil, "", newError(400, "InvalidParameterException", "Invalid pagination token %s", token)
+		}
+	}
+
+	end := len(names)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+		return names[start:end], strconv.Itoa(end), nil
+	}
+	return names[start:end], "", nil
+}
+
+// lastSegment returns the name at the end of an ARN or path, the form most
+// APIs accept next to the plain name.
+func lastSegment(nameOrArn, separator string) string {
+	if i := strings.LastIndex(nameOrArn, separator); i >= 0 {
+		return nameOrArn[i+len(separator):]
+	}
+	return nameOrArn
+}
+
+// containsString returns whether the value is one of the values.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}